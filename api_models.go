@@ -0,0 +1,132 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+// JSON representations served by the REST API; the sqlc models carry no json tags
+
+type User struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// APIKey is only returned when the user is created
+	APIKey string `json:"api_key,omitempty"`
+}
+
+type Feed struct {
+	ID            uuid.UUID  `json:"id"`
+	Name          string     `json:"name"`
+	URL           string     `json:"url"`
+	UserID        uuid.UUID  `json:"user_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	LastFetchedAt *time.Time `json:"last_fetched_at"`
+}
+
+type FeedFollow struct {
+	ID        uuid.UUID `json:"id"`
+	FeedID    uuid.UUID `json:"feed_id"`
+	FeedName  string    `json:"feed_name"`
+	UserID    uuid.UUID `json:"user_id"`
+	Category  string    `json:"category"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Post struct {
+	ID          uuid.UUID `json:"id"`
+	FeedID      uuid.UUID `json:"feed_id"`
+	FeedName    string    `json:"feed_name,omitempty"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	PublishedAt time.Time `json:"published_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func databaseUserToUser(user database.User) User {
+	return User{
+		ID:        user.ID,
+		Name:      user.Name,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
+
+func databaseFeedToFeed(feed database.Feed) Feed {
+	return Feed{
+		ID:            feed.ID,
+		Name:          feed.Name,
+		URL:           feed.Url,
+		UserID:        feed.UserID,
+		CreatedAt:     feed.CreatedAt,
+		UpdatedAt:     feed.UpdatedAt,
+		LastFetchedAt: nullTimeToPtr(feed.LastFetchedAt),
+	}
+}
+
+func databaseFeedFollowToFeedFollow(follow database.GetFeedFollowsForUserRow) FeedFollow {
+	return FeedFollow{
+		ID:        follow.ID,
+		FeedID:    follow.FeedID,
+		FeedName:  follow.FeedName,
+		UserID:    follow.UserID,
+		Category:  follow.Category,
+		CreatedAt: follow.CreatedAt,
+	}
+}
+
+func databasePostToPost(post database.GetPostsForUserRow) Post {
+	return Post{
+		ID:          post.ID,
+		FeedID:      post.FeedID,
+		FeedName:    post.FeedName,
+		Title:       post.Title,
+		URL:         post.Url,
+		Description: post.Description,
+		PublishedAt: post.PublishedAt,
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+	}
+}
+
+func databaseFollowedPostToPost(post database.GetFollowedPostRow) Post {
+	return Post{
+		ID:          post.ID,
+		FeedID:      post.FeedID,
+		FeedName:    post.FeedName,
+		Title:       post.Title,
+		URL:         post.Url,
+		Description: post.Description,
+		PublishedAt: post.PublishedAt,
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+	}
+}
+
+func databaseCreatedPostToPost(post database.CreatePostRow, feedName string) Post {
+	return Post{
+		ID:          post.ID,
+		FeedID:      post.FeedID,
+		FeedName:    feedName,
+		Title:       post.Title,
+		URL:         post.Url,
+		Description: post.Description,
+		PublishedAt: post.PublishedAt,
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+	}
+}
+
+func nullTimeToPtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
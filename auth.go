@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jsleep/blog_aggregator/internal/database"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+const sessionDuration = 30 * 24 * time.Hour
+
+// generateToken returns a new random API key or session token and the hash stored in its place
+func generateToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// hashToken is a plain sha256: tokens are long and random, so they don't need a slow hash
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// startSession logs user in by storing a fresh session token in the config,
+// replacing whichever session was there before
+func startSession(s *state, user database.User) error {
+	token, tokenHash, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	err = s.db.InTx(context.Background(), func(q database.Querier) error {
+		err := q.CreateSession(context.Background(), database.CreateSessionParams{
+			TokenHash: tokenHash,
+			UserID:    user.ID,
+			CreatedAt: time.Now(),
+			ExpiresAt: time.Now().Add(sessionDuration),
+		})
+		if err != nil || s.Config.SessionToken == "" {
+			return err
+		}
+		return q.DeleteSession(context.Background(), hashToken(s.Config.SessionToken))
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.Config.SetSession(user.Name, token)
+}
+
+// hashPassword returns an empty hash for an empty password, which leaves the account without one
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func checkPassword(user database.User, password string) error {
+	if !user.PasswordHash.Valid {
+		return nil
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash.String), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return errors.New("invalid password")
+	}
+	return err
+}
+
+// stdin is shared by every prompt so buffered input isn't lost between reads
+var stdin = bufio.NewReader(os.Stdin)
+
+// readPassword prompts without echoing when attached to a terminal, and
+// otherwise reads a line so passwords can be piped in from scripts
+func readPassword(prompt string) (string, error) {
+	fmt.Print(prompt)
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		b, err := term.ReadPassword(fd)
+		fmt.Println()
+		return string(b), err
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// promptNewPassword asks for a password twice; an empty answer means no password
+func promptNewPassword() (string, error) {
+	password, err := readPassword("Password (leave empty for none): ")
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", nil
+	}
+
+	confirm, err := readPassword("Confirm password: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm != password {
+		return "", errors.New("passwords do not match")
+	}
+
+	return password, nil
+}
+
+func rotateKeyHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "rotate-key"
+	if cmd.Command != "rotate-key" {
+		return fmt.Errorf("invalid command")
+	}
+
+	key, hash, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	err = s.db.SetUserAPIKey(context.Background(), database.SetUserAPIKeyParams{
+		ID:         user.ID,
+		ApiKeyHash: nullString(hash),
+		UpdatedAt:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("New API key for %s: %s\n", user.Name, key)
+	fmt.Println("The previous key no longer works. Store this one now, it can't be shown again.")
+
+	return nil
+}
+
+func passwdHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "passwd"
+	if cmd.Command != "passwd" {
+		return fmt.Errorf("invalid command")
+	}
+
+	password, err := promptNewPassword()
+	if err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// sessions opened before, possibly by someone else while there was no
+	// password, end with the change; only this one stays signed in
+	var signedOut int64
+	err = s.db.InTx(context.Background(), func(q database.Querier) error {
+		err := q.SetUserPassword(context.Background(), database.SetUserPasswordParams{
+			ID:           user.ID,
+			PasswordHash: nullString(hash),
+			UpdatedAt:    time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		signedOut, err = q.DeleteSessionsForUser(context.Background(), database.DeleteSessionsForUserParams{
+			UserID:    user.ID,
+			TokenHash: hashToken(s.Config.SessionToken),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if password == "" {
+		fmt.Printf("Password removed for %s\n", user.Name)
+	} else {
+		fmt.Printf("Password updated for %s\n", user.Name)
+	}
+	if signedOut > 0 {
+		fmt.Printf("Signed out %d other sessions\n", signedOut)
+	}
+
+	return nil
+}
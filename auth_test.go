@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+func TestRotateKey(t *testing.T) {
+	s := newTestState(t)
+	registerUser(t, s, "alice")
+	before, err := s.db.GetUserByName(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := mustRun(t, s, "rotate-key")
+	_, key, ok := strings.Cut(strings.SplitN(out, "\n", 2)[0], "New API key for alice: ")
+	if !ok || key == "" {
+		t.Fatalf("no key printed:\n%s", out)
+	}
+
+	user, err := s.db.GetUserByAPIKey(context.Background(), nullString(hashToken(key)))
+	if err != nil {
+		t.Fatalf("new key doesn't authenticate: %v", err)
+	}
+	if user.Name != "alice" {
+		t.Errorf("key belongs to %s", user.Name)
+	}
+	if _, err := s.db.GetUserByAPIKey(context.Background(), before.ApiKeyHash); err == nil {
+		t.Error("the previous key still works")
+	}
+}
+
+func TestPasswd(t *testing.T) {
+	s := newTestState(t)
+	alice := registerUser(t, s, "alice")
+	own := s.Config.SessionToken
+
+	// without a password anyone could have logged in as alice elsewhere
+	const intruder = "intruder"
+	err := s.db.CreateSession(context.Background(), database.CreateSessionParams{
+		TokenHash: hashToken(intruder),
+		UserID:    alice.ID,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setStdin(t, "s3cret\ns3cret\n")
+	out := mustRun(t, s, "passwd")
+	if !strings.Contains(out, "Password updated for alice") || !strings.Contains(out, "Signed out 1 other sessions") {
+		t.Errorf("unexpected passwd output:\n%s", out)
+	}
+	mustRun(t, s, "following")
+	s.Config.SessionToken = intruder
+	if _, err := run(t, s, "following"); err == nil {
+		t.Error("a session from before the password was set still works")
+	}
+	s.Config.SessionToken = own
+	setStdin(t, "nope\n")
+	if _, err := run(t, s, "login", "alice"); err == nil {
+		t.Error("login accepted the wrong password")
+	}
+	setStdin(t, "s3cret\n")
+	mustRun(t, s, "login", "alice")
+
+	setStdin(t, "new\nold\n")
+	if _, err := run(t, s, "passwd"); err == nil {
+		t.Error("expected mismatched passwords to fail")
+	}
+
+	// an empty password removes it
+	setStdin(t, "\n")
+	out = mustRun(t, s, "passwd")
+	if !strings.Contains(out, "Password removed for alice") {
+		t.Errorf("unexpected passwd output:\n%s", out)
+	}
+	user, err := s.db.GetUserByName(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.PasswordHash.Valid {
+		t.Error("password was not removed")
+	}
+}
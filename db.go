@@ -0,0 +1,44 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jsleep/blog_aggregator/internal/database"
+	"github.com/jsleep/blog_aggregator/internal/sqlitedb"
+	"github.com/pressly/goose/v3"
+	_ "modernc.org/sqlite"
+)
+
+// sqlitePragmas are applied to every SQLite connection: foreign keys make the
+// schema's cascades work, the busy timeout lets agg and serve share a file,
+// and the sqlite time format keeps timestamps readable by julianday()
+const sqlitePragmas = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite"
+
+// openStore connects to the database named by db_url, either sqlite:<path>
+// for a local file or anything lib/pq accepts, a postgres:// URL or a
+// "host=... dbname=..." connection string. It returns the connection pool,
+// the store built on it and the dialect its migrations are written in.
+func openStore(dbURL string) (*sql.DB, database.Store, goose.Dialect, error) {
+	if !strings.HasPrefix(dbURL, "sqlite:") {
+		db, err := sql.Open("postgres", dbURL)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return db, database.NewStore(db), goose.DialectPostgres, nil
+	}
+
+	path := strings.TrimPrefix(strings.TrimPrefix(dbURL, "sqlite:"), "//")
+	if path == "" {
+		return nil, nil, "", fmt.Errorf("missing file path in db_url %s", dbURL)
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?"+sqlitePragmas)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	// SQLite allows one writer at a time; queueing them here is cheaper
+	// than retrying on SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	return db, sqlitedb.NewStore(db), goose.DialectSQLite3, nil
+}
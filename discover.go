@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// discoveredFeed is a feed advertised by (or probed next to) an HTML page
+type discoveredFeed struct {
+	Title string
+	URL   string
+}
+
+// feedLinkTypes are the <link rel="alternate"> types that point at a feed
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/rdf+xml":   true,
+	"application/feed+json": true,
+}
+
+// errNoFeedFound means the page was fetched but neither is a feed nor leads to one
+var errNoFeedFound = errors.New("no feed found")
+
+// commonFeedPaths are probed when a page doesn't advertise any feed
+var commonFeedPaths = []string{
+	"/feed",
+	"/rss",
+	"/index.xml",
+	"/feed.xml",
+	"/atom.xml",
+	"/rss.xml",
+	"/feed.json",
+}
+
+// discoverFeeds returns the feeds found at pageURL. A URL that is already a
+// feed is returned as is; otherwise the page's alternate links are used,
+// falling back to probing common feed paths on the same site.
+func discoverFeeds(ctx context.Context, pageURL string) ([]discoveredFeed, error) {
+	body, contentType, base, err := fetchDocument(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if feed, err := parseFeed(body, contentType); err == nil {
+		return []discoveredFeed{{Title: feed.Channel.Title, URL: pageURL}}, nil
+	}
+
+	feeds := feedLinks(body, base)
+	if len(feeds) > 0 {
+		return feeds, nil
+	}
+
+	for _, path := range commonFeedPaths {
+		candidate := base.ResolveReference(&url.URL{Path: path}).String()
+		body, contentType, _, err := fetchDocument(ctx, candidate)
+		if err != nil {
+			continue
+		}
+		if feed, err := parseFeed(body, contentType); err == nil {
+			return []discoveredFeed{{Title: feed.Channel.Title, URL: candidate}}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w at %s", errNoFeedFound, pageURL)
+}
+
+// fetchDocument returns the body and content type of docURL along with the
+// URL it was finally served from, so relative links resolve after redirects
+func fetchDocument(ctx context.Context, docURL string) ([]byte, string, *url.URL, error) {
+	r, err := newFeedRequest(ctx, docURL)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	resp, err := feedClient.Do(r)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", nil, fmt.Errorf("failed to fetch %s: %s", docURL, resp.Status)
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return b, resp.Header.Get("Content-Type"), resp.Request.URL, nil
+}
+
+// feedLinks collects <link rel="alternate"> feed references from an HTML page
+func feedLinks(body []byte, base *url.URL) []discoveredFeed {
+	var feeds []discoveredFeed
+	seen := map[string]bool{}
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return feeds
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			switch tok.Data {
+			case "base":
+				// <base href> changes how every later relative link resolves
+				if href := attr(tok, "href"); href != "" {
+					if u, err := base.Parse(href); err == nil {
+						base = u
+					}
+				}
+			case "link":
+				if !hasToken(attr(tok, "rel"), "alternate") {
+					continue
+				}
+				if !feedLinkTypes[strings.ToLower(strings.TrimSpace(attr(tok, "type")))] {
+					continue
+				}
+				href := attr(tok, "href")
+				if href == "" {
+					continue
+				}
+				u, err := base.Parse(href)
+				if err != nil || seen[u.String()] {
+					continue
+				}
+				seen[u.String()] = true
+				feeds = append(feeds, discoveredFeed{Title: attr(tok, "title"), URL: u.String()})
+			case "body":
+				// feed links only live in <head>
+				return feeds
+			}
+		}
+	}
+}
+
+func attr(tok html.Token, name string) string {
+	for _, a := range tok.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasToken reports whether the space separated list contains token
+func hasToken(list, token string) bool {
+	for _, field := range strings.Fields(list) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveFeedURL turns whatever the user pasted into a single feed URL,
+// asking them to choose when the page offers several feeds. A URL that can't
+// be checked right now is kept as given; one that was checked and holds no
+// feed is an error.
+func resolveFeedURL(ctx context.Context, pageURL string) (string, error) {
+	feeds, err := discoverFeeds(ctx, pageURL)
+	if errors.Is(err, errNoFeedFound) {
+		return "", err
+	}
+	if err != nil {
+		// the site may be down or turn gator away; agg retries it with backoff
+		fmt.Printf("Warning: could not find a feed at %s, adding it as given: %v\n", pageURL, err)
+		return pageURL, nil
+	}
+	if len(feeds) == 1 {
+		return feeds[0].URL, nil
+	}
+
+	fmt.Printf("%s offers several feeds:\n", pageURL)
+	for i, feed := range feeds {
+		fmt.Printf("  %d) %s %s\n", i+1, feed.Title, feed.URL)
+	}
+	fmt.Printf("Pick a feed [1-%d]: ", len(feeds))
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("no feed selected")
+	}
+	choice, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || choice < 1 || choice > len(feeds) {
+		return "", fmt.Errorf("invalid choice: %s", strings.TrimSpace(line))
+	}
+
+	return feeds[choice-1].URL, nil
+}
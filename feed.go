@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RSSFeed is the common model every supported feed format is normalized into
+type RSSFeed struct {
+	Channel struct {
+		Title       string    `xml:"title"`
+		Link        string    `xml:"link"`
+		Description string    `xml:"description"`
+		Item        []RSSItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type RSSItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	PubDate     string `xml:"pubDate"`
+	GUID        string `xml:"guid"`
+}
+
+// rdfFeed is RSS 1.0, where items are siblings of the channel rather than children
+type rdfFeed struct {
+	Channel struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+	} `xml:"channel"`
+	Items []rdfItem `xml:"item"`
+}
+
+type rdfItem struct {
+	About       string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type atomFeed struct {
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Links     []atomLink  `xml:"link"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published"`
+	Summary   atomContent `xml:"summary"`
+	Content   atomContent `xml:"content"`
+}
+
+// atomContent is a text construct, whose type attribute says how its body is encoded
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+	// xhtml content is wrapped in a single div that isn't part of the content
+	Div struct {
+		Body string `xml:",innerxml"`
+	} `xml:"div"`
+}
+
+// String returns the body as html markup, escaping plain text so it can't
+// be mistaken for markup
+func (t atomContent) String() string {
+	switch t.Type {
+	case "xhtml":
+		return strings.TrimSpace(t.Div.Body)
+	case "html":
+		return strings.TrimSpace(t.Text)
+	default:
+		return html.EscapeString(strings.TrimSpace(t.Text))
+	}
+}
+
+// jsonFeed follows https://www.jsonfeed.org/version/1.1/
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	Description string         `json:"description"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	// the spec asks for a string, but plenty of feeds publish numeric ids
+	ID            json.RawMessage `json:"id"`
+	URL           string          `json:"url"`
+	Title         string          `json:"title"`
+	ContentHTML   string          `json:"content_html"`
+	ContentText   string          `json:"content_text"`
+	Summary       string          `json:"summary"`
+	DatePublished string          `json:"date_published"`
+	DateModified  string          `json:"date_modified"`
+}
+
+// feedCacheHeaders are the validators sent back to the publisher on the next conditional GET
+type feedCacheHeaders struct {
+	ETag         string
+	LastModified string
+}
+
+// errFeedNotModified is returned by fetchFeed when the publisher answers 304 Not Modified
+var errFeedNotModified = errors.New("feed not modified")
+
+// feedClient fetches feeds and the pages they are discovered on. The timeout
+// covers reading the body too, so a site that never answers fails like any
+// other instead of holding up the agg cycle.
+var feedClient = &http.Client{Timeout: 30 * time.Second}
+
+func newFeedRequest(ctx context.Context, feedURL string) (*http.Request, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("User-Agent", "gator")
+	r.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/feed+json, application/xml;q=0.9, */*;q=0.8")
+	return r, nil
+}
+
+func fetchFeed(ctx context.Context, feedURL string, cache feedCacheHeaders) (*RSSFeed, feedCacheHeaders, error) {
+	r, err := newFeedRequest(ctx, feedURL)
+	if err != nil {
+		return nil, cache, err
+	}
+	if cache.ETag != "" {
+		r.Header.Set("If-None-Match", cache.ETag)
+	}
+	if cache.LastModified != "" {
+		r.Header.Set("If-Modified-Since", cache.LastModified)
+	}
+	resp, err := feedClient.Do(r)
+	if err != nil {
+		return nil, cache, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, cache, errFeedNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, cache, fmt.Errorf("failed to fetch feed: %s", resp.Status)
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, cache, err
+	}
+
+	feed, err := parseFeed(b, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, cache, err
+	}
+
+	// titles are plain text, but publishers often escape entities in them twice
+	feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
+	for i := range feed.Channel.Item {
+		feed.Channel.Item[i].Title = html.UnescapeString(feed.Channel.Item[i].Title)
+		feed.Channel.Item[i].GUID = strings.TrimSpace(feed.Channel.Item[i].GUID)
+	}
+
+	return feed, feedCacheHeaders{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// parseFeed picks a parser based on the content type, falling back to sniffing the document
+func parseFeed(b []byte, contentType string) (*RSSFeed, error) {
+	if isJSONFeed(b, contentType) {
+		return parseJSONFeed(b)
+	}
+
+	root, err := rootElement(b)
+	if err != nil {
+		return nil, err
+	}
+
+	switch root.Local {
+	case "rss":
+		var feed RSSFeed
+		if err := xml.Unmarshal(b, &feed); err != nil {
+			return nil, err
+		}
+		unescapeDescriptions(&feed)
+		return &feed, nil
+	case "feed":
+		return parseAtom(b)
+	case "RDF":
+		return parseRDF(b)
+	default:
+		return nil, fmt.Errorf("unsupported feed format: <%s>", root.Local)
+	}
+}
+
+func rootElement(b []byte) (xml.Name, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return xml.Name{}, fmt.Errorf("empty feed document")
+			}
+			return xml.Name{}, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+// unescapeDescriptions decodes RSS descriptions, which carry their html as
+// escaped text. Atom and JSON Feed say how their content is encoded, so they
+// are decoded by their parsers instead.
+func unescapeDescriptions(feed *RSSFeed) {
+	feed.Channel.Description = html.UnescapeString(feed.Channel.Description)
+	for i := range feed.Channel.Item {
+		feed.Channel.Item[i].Description = html.UnescapeString(feed.Channel.Item[i].Description)
+	}
+}
+
+func parseRDF(b []byte) (*RSSFeed, error) {
+	var rdf rdfFeed
+	if err := xml.Unmarshal(b, &rdf); err != nil {
+		return nil, err
+	}
+
+	var feed RSSFeed
+	feed.Channel.Title = rdf.Channel.Title
+	feed.Channel.Link = rdf.Channel.Link
+	feed.Channel.Description = rdf.Channel.Description
+
+	for _, item := range rdf.Items {
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			Title:       item.Title,
+			Link:        strings.TrimSpace(item.Link),
+			Description: item.Description,
+			PubDate:     strings.TrimSpace(item.Date),
+			GUID:        strings.TrimSpace(item.About),
+		})
+	}
+	unescapeDescriptions(&feed)
+
+	return &feed, nil
+}
+
+func parseAtom(b []byte) (*RSSFeed, error) {
+	var atom atomFeed
+	if err := xml.Unmarshal(b, &atom); err != nil {
+		return nil, err
+	}
+
+	var feed RSSFeed
+	feed.Channel.Title = atom.Title
+	feed.Channel.Link = atomAlternateLink(atom.Links)
+	feed.Channel.Description = atom.Subtitle
+
+	for _, entry := range atom.Entries {
+		// prefer the original publication date, falling back to the last update
+		pubDate := entry.Published
+		if pubDate == "" {
+			pubDate = entry.Updated
+		}
+
+		description := entry.Summary.String()
+		if description == "" {
+			description = entry.Content.String()
+		}
+
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			Title:       entry.Title,
+			Link:        atomAlternateLink(entry.Links),
+			Description: strings.TrimSpace(description),
+			PubDate:     strings.TrimSpace(pubDate),
+			GUID:        strings.TrimSpace(entry.ID),
+		})
+	}
+
+	return &feed, nil
+}
+
+// atomAlternateLink returns the rel="alternate" link, which is the default when rel is omitted
+func atomAlternateLink(links []atomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	if len(links) > 0 {
+		return links[0].Href
+	}
+	return ""
+}
+
+func isJSONFeed(b []byte, contentType string) bool {
+	if strings.Contains(contentType, "json") {
+		return true
+	}
+	trimmed := bytes.TrimSpace(b)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+func parseJSONFeed(b []byte) (*RSSFeed, error) {
+	var jf jsonFeed
+	if err := json.Unmarshal(b, &jf); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(jf.Version, "https://jsonfeed.org/version/") {
+		return nil, fmt.Errorf("unsupported json feed version: %q", jf.Version)
+	}
+
+	var feed RSSFeed
+	feed.Channel.Title = jf.Title
+	feed.Channel.Link = jf.HomePageURL
+	feed.Channel.Description = jf.Description
+
+	for _, item := range jf.Items {
+		id := jsonFeedID(item.ID)
+
+		// items without a url fall back to their id, which is often a permalink
+		link := item.URL
+		if link == "" {
+			link = id
+		}
+
+		// only content_html is markup; descriptions are stored as html
+		description := item.ContentHTML
+		if description == "" {
+			description = html.EscapeString(item.ContentText)
+		}
+		if description == "" {
+			description = html.EscapeString(item.Summary)
+		}
+
+		pubDate := item.DatePublished
+		if pubDate == "" {
+			pubDate = item.DateModified
+		}
+
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			Title:       item.Title,
+			Link:        link,
+			Description: description,
+			PubDate:     pubDate,
+			GUID:        id,
+		})
+	}
+
+	return &feed, nil
+}
+
+// jsonFeedID reads an item id given as either a string or a number; any other
+// id is ignored, leaving the item to be identified by its url
+func jsonFeedID(raw json.RawMessage) string {
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n.String()
+	}
+	return ""
+}
+
+// itemGUID identifies an item within its feed, falling back to the link for feeds without guids
+func itemGUID(item RSSItem) string {
+	if item.GUID != "" {
+		return item.GUID
+	}
+	return item.Link
+}
+
+// itemContentHash changes whenever the publisher edits an item
+func itemContentHash(item RSSItem) string {
+	h := sha256.New()
+	for _, field := range []string{item.Title, item.Link, item.Description} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
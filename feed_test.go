@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseFeed(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		doc         string
+		title, link string
+		items       []RSSItem
+		wantErr     bool
+	}{
+		{
+			name: "rss",
+			doc: `<?xml version="1.0"?>
+<rss version="2.0"><channel>
+  <title>Example</title><link>https://example.com/</link>
+  <item><title>One</title><link>https://example.com/1</link><description>first</description>
+    <pubDate>Tue, 02 Jan 2024 12:00:00 +0000</pubDate><guid>post-1</guid></item>
+</channel></rss>`,
+			title: "Example",
+			link:  "https://example.com/",
+			items: []RSSItem{
+				{Title: "One", Link: "https://example.com/1", Description: "first", PubDate: "Tue, 02 Jan 2024 12:00:00 +0000", GUID: "post-1"},
+			},
+		},
+		{
+			name:        "atom",
+			contentType: "application/atom+xml",
+			doc: `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Example</title><subtitle>A blog</subtitle>
+  <link rel="self" href="https://example.com/atom.xml"/>
+  <link href="https://example.com/"/>
+  <entry>
+    <id>tag:example.com,2024:1</id><title>Published</title>
+    <link rel="edit" href="https://example.com/edit/1"/>
+    <link rel="alternate" href="https://example.com/1"/>
+    <published>2024-01-02T12:00:00Z</published><updated>2024-01-05T12:00:00Z</updated>
+    <summary>The summary</summary><content type="html">&lt;p&gt;The content&lt;/p&gt;</content>
+  </entry>
+  <entry>
+    <id>tag:example.com,2024:2</id><title>Updated only</title>
+    <link href="https://example.com/2"/>
+    <updated>2024-01-03T12:00:00Z</updated>
+    <content type="html">&lt;p&gt;Escaped &amp;amp; html&lt;/p&gt;</content>
+  </entry>
+  <entry>
+    <id>tag:example.com,2024:3</id><title>Xhtml</title>
+    <link href="https://example.com/3"/>
+    <updated>2024-01-04T12:00:00Z</updated>
+    <content type="xhtml">
+      <div xmlns="http://www.w3.org/1999/xhtml"><p>Inline <em>markup</em></p></div>
+    </content>
+  </entry>
+  <entry>
+    <id>tag:example.com,2024:4</id><title>Text</title>
+    <link href="https://example.com/4"/>
+    <updated>2024-01-05T12:00:00Z</updated>
+    <summary type="text">  1 &lt; 2  </summary>
+  </entry>
+</feed>`,
+			title: "Example",
+			link:  "https://example.com/",
+			items: []RSSItem{
+				{Title: "Published", Link: "https://example.com/1", Description: "The summary", PubDate: "2024-01-02T12:00:00Z", GUID: "tag:example.com,2024:1"},
+				{Title: "Updated only", Link: "https://example.com/2", Description: "<p>Escaped &amp; html</p>", PubDate: "2024-01-03T12:00:00Z", GUID: "tag:example.com,2024:2"},
+				{Title: "Xhtml", Link: "https://example.com/3", Description: "<p>Inline <em>markup</em></p>", PubDate: "2024-01-04T12:00:00Z", GUID: "tag:example.com,2024:3"},
+				{Title: "Text", Link: "https://example.com/4", Description: "1 &lt; 2", PubDate: "2024-01-05T12:00:00Z", GUID: "tag:example.com,2024:4"},
+			},
+		},
+		{
+			name: "rdf",
+			doc: `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <channel rdf:about="https://example.com/">
+    <title>Example</title><link>https://example.com/</link><description>A blog</description>
+  </channel>
+  <item rdf:about="https://example.com/1">
+    <title>One</title><link>
+      https://example.com/1
+    </link><description>first</description>
+    <dc:date>2024-01-02T12:00:00+00:00</dc:date>
+  </item>
+  <item rdf:about="https://example.com/2">
+    <title>Two</title><link>https://example.com/2</link>
+  </item>
+</rdf:RDF>`,
+			title: "Example",
+			link:  "https://example.com/",
+			items: []RSSItem{
+				{Title: "One", Link: "https://example.com/1", Description: "first", PubDate: "2024-01-02T12:00:00+00:00", GUID: "https://example.com/1"},
+				{Title: "Two", Link: "https://example.com/2", GUID: "https://example.com/2"},
+			},
+		},
+		{
+			name:        "json feed",
+			contentType: "application/feed+json",
+			doc: `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "Example", "home_page_url": "https://example.com/",
+  "items": [
+    {"id": "https://example.com/1", "title": "Id as link", "content_html": "<p>html</p>", "content_text": "text", "date_published": "2024-01-02T12:00:00Z"},
+    {"id": 2, "url": "https://example.com/2", "title": "Numeric id", "content_text": "1 < 2", "date_modified": "2024-01-03T12:00:00Z"},
+    {"id": 12345678901234567890, "url": "https://example.com/3", "title": "Big id", "summary": "summary"},
+    {"id": {"not": "an id"}, "url": "https://example.com/4", "title": "Odd id"}
+  ]
+}`,
+			title: "Example",
+			link:  "https://example.com/",
+			items: []RSSItem{
+				{Title: "Id as link", Link: "https://example.com/1", Description: "<p>html</p>", PubDate: "2024-01-02T12:00:00Z", GUID: "https://example.com/1"},
+				{Title: "Numeric id", Link: "https://example.com/2", Description: "1 &lt; 2", PubDate: "2024-01-03T12:00:00Z", GUID: "2"},
+				{Title: "Big id", Link: "https://example.com/3", Description: "summary", GUID: "12345678901234567890"},
+				{Title: "Odd id", Link: "https://example.com/4"},
+			},
+		},
+		{
+			name:    "json feed without a version",
+			doc:     `{"title": "Example", "items": []}`,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported",
+			doc:     `<html><body>not a feed</body></html>`,
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			feed, err := parseFeed([]byte(tt.doc), tt.contentType)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if feed.Channel.Title != tt.title || feed.Channel.Link != tt.link {
+				t.Errorf("channel %q %q, want %q %q", feed.Channel.Title, feed.Channel.Link, tt.title, tt.link)
+			}
+			if !slices.Equal(feed.Channel.Item, tt.items) {
+				t.Errorf("items:\n%+v\nwant:\n%+v", feed.Channel.Item, tt.items)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	for _, value := range []string{
+		"Tue, 02 Jan 2024 12:00:00 +0000",
+		"Tue, 02 Jan 2024 12:00:00 UTC",
+		"2024-01-02T12:00:00Z",
+		"2024-01-02T14:00:00+02:00",
+		// dc:date may leave out the seconds, or the time altogether
+		"2024-01-02T12:00Z",
+		"2024-01-02T13:00+01:00",
+	} {
+		got, err := parseTime(value)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseTime(%q) = %v, %v", value, got, err)
+		}
+	}
+
+	if got, err := parseTime("2024-01-02"); err != nil || !got.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseTime of a date = %v, %v", got, err)
+	}
+	if _, err := parseTime("yesterday"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+// TestFetchDescriptions checks that descriptions come out of fetchFeed as the
+// html their format says they are, decoded exactly once
+func TestFetchDescriptions(t *testing.T) {
+	docs := map[string]string{
+		"/rss": `<rss version="2.0"><channel><title>Example &amp;amp; co</title>
+  <item><title>One</title><description>&lt;p&gt;first&lt;/p&gt;</description></item>
+</channel></rss>`,
+		"/atom": `<feed xmlns="http://www.w3.org/2005/Atom"><title>Example</title>
+  <entry><id>1</id><content type="html">&lt;p&gt;Use &amp;lt;div&amp;gt; here&lt;/p&gt;</content></entry>
+  <entry><id>2</id><content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>a &lt;script&gt; tag</p></div></content></entry>
+  <entry><id>3</id><content type="text">1 &lt; 2</content></entry>
+</feed>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(doc))
+	}))
+	defer srv.Close()
+
+	for path, want := range map[string][]string{
+		"/rss":  {"<p>first</p>"},
+		"/atom": {"<p>Use &lt;div&gt; here</p>", "<p>a &lt;script&gt; tag</p>", "1 &lt; 2"},
+	} {
+		feed, _, err := fetchFeed(context.Background(), srv.URL+path, feedCacheHeaders{})
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		var got []string
+		for _, item := range feed.Channel.Item {
+			got = append(got, item.Description)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: descriptions %q, want %q", path, got, want)
+		}
+		if path == "/rss" && feed.Channel.Title != "Example & co" {
+			t.Errorf("%s: title %q", path, feed.Channel.Title)
+		}
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	s := newTestState(t)
+	alice := registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"))
+
+	const etag, lastModified = `"v1"`, "Tue, 02 Jan 2024 12:00:00 GMT"
+	var mu sync.Mutex
+	var conditional []string
+	feeds := fs.Config.Handler
+	fs.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		conditional = append(conditional, r.Header.Get("If-None-Match")+" "+r.Header.Get("If-Modified-Since"))
+		mu.Unlock()
+
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		feeds.ServeHTTP(w, r)
+	})
+
+	feed := addFeed(t, s, "Example", fs)
+	if feed.Etag.String != etag || feed.LastModified.String != lastModified {
+		t.Fatalf("validators not stored: %q %q", feed.Etag.String, feed.LastModified.String)
+	}
+
+	// the publisher has nothing new, so the stored posts are left alone
+	fs.setItems(testItem(1, "One (edited)", "first"))
+	out := mustRun(t, s, "agg", "--once")
+	if !strings.Contains(out, "Feed Example not modified") || strings.Contains(out, "Post ") {
+		t.Errorf("unexpected agg output:\n%s", out)
+	}
+	if got := postTitles(t, s, alice); !slices.Equal(got, []string{"One"}) {
+		t.Errorf("posts changed on a 304: %v", got)
+	}
+
+	refetched, err := s.db.GetFeed(context.Background(), fs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refetched.ErrorCount != 0 || !refetched.LastFetchedAt.Time.After(feed.LastFetchedAt.Time) {
+		t.Errorf("a 304 should count as a successful fetch: %+v", refetched)
+	}
+	if refetched.Etag.String != etag || refetched.LastModified.String != lastModified {
+		t.Errorf("validators lost after a 304: %q %q", refetched.Etag.String, refetched.LastModified.String)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := conditional[len(conditional)-1], etag+" "+lastModified; got != want {
+		t.Errorf("sent validators %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+// Fever API (https://feedafever.com/api) for Reeder, NetNewsWire and other
+// mobile readers. Groups are the categories of the user's feed follows, and
+// feeds and items are identified by their fever_id columns.
+
+const (
+	feverAPIVersion = 3
+	feverPageSize   = 50
+)
+
+type feverGroup struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+type feverFeedsGroup struct {
+	GroupID int    `json:"group_id"`
+	FeedIDs string `json:"feed_ids"`
+}
+
+type feverFeed struct {
+	ID                int64  `json:"id"`
+	FaviconID         int64  `json:"favicon_id"`
+	Title             string `json:"title"`
+	URL               string `json:"url"`
+	SiteURL           string `json:"site_url"`
+	IsSpark           int    `json:"is_spark"`
+	LastUpdatedOnTime int64  `json:"last_updated_on_time"`
+}
+
+type feverItem struct {
+	ID            int64  `json:"id"`
+	FeedID        int64  `json:"feed_id"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	HTML          string `json:"html"`
+	URL           string `json:"url"`
+	IsSaved       int    `json:"is_saved"`
+	IsRead        int    `json:"is_read"`
+	CreatedOnTime int64  `json:"created_on_time"`
+}
+
+func feverPasswordHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "fever-password"
+	if cmd.Command != "fever-password" {
+		return fmt.Errorf("invalid command")
+	}
+
+	password, err := promptNewPassword()
+	if err != nil {
+		return err
+	}
+
+	// clients send md5("username:password"); like api keys we only keep a hash of it
+	var keyHash string
+	if password != "" {
+		keyHash = hashToken(feverAPIKey(user.Name, password))
+	}
+
+	err = s.db.SetUserFeverKey(context.Background(), database.SetUserFeverKeyParams{
+		ID:          user.ID,
+		FeverApiKey: nullString(keyHash),
+		UpdatedAt:   time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if password == "" {
+		fmt.Printf("Fever access disabled for %s\n", user.Name)
+	} else {
+		fmt.Printf("Fever access enabled for %s. Log in with username %q and this password.\n", user.Name, user.Name)
+	}
+
+	return nil
+}
+
+func feverAPIKey(username, password string) string {
+	sum := md5.Sum([]byte(username + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiFever serves every Fever request: the query string selects what to
+// return and the api_key form value authenticates the user
+func apiFever(s *state, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if !query.Has("api") {
+		respondWithError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	resp := map[string]any{
+		"api_version": feverAPIVersion,
+		"auth":        0,
+	}
+
+	key := strings.ToLower(r.FormValue("api_key"))
+	if key == "" {
+		respondWithJSON(w, http.StatusOK, resp)
+		return
+	}
+	user, err := s.db.GetUserByFeverKey(r.Context(), nullString(hashToken(key)))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithJSON(w, http.StatusOK, resp)
+		return
+	}
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+	resp["auth"] = 1
+
+	if err := feverRespond(r, s, user, resp); err != nil {
+		var badRequest feverError
+		if errors.As(err, &badRequest) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondWithDBError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// feverError is an invalid request parameter rather than a database failure
+type feverError string
+
+func (e feverError) Error() string {
+	return string(e)
+}
+
+func feverRespond(r *http.Request, s *state, user database.User, resp map[string]any) error {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	// marks are applied first so the lists returned below already reflect them
+	if mark := r.FormValue("mark"); mark != "" {
+		if err := feverMark(r, s, user, mark, resp); err != nil {
+			return err
+		}
+	}
+
+	feeds, err := s.db.GetFeverFeedsForUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	var lastRefreshed time.Time
+	for _, feed := range feeds {
+		if feed.LastFetchedAt.Valid && feed.LastFetchedAt.Time.After(lastRefreshed) {
+			lastRefreshed = feed.LastFetchedAt.Time
+		}
+	}
+	resp["last_refreshed_on_time"] = unixTime(lastRefreshed)
+
+	if query.Has("groups") || query.Has("feeds") {
+		groups, feedsGroups := feverGroups(feeds)
+		if query.Has("groups") {
+			resp["groups"] = groups
+		}
+		resp["feeds_groups"] = feedsGroups
+	}
+
+	if query.Has("feeds") {
+		out := make([]feverFeed, 0, len(feeds))
+		for _, feed := range feeds {
+			out = append(out, feverFeed{
+				ID:                feed.FeverID,
+				Title:             feed.Name,
+				URL:               feed.Url,
+				LastUpdatedOnTime: unixTime(feed.LastFetchedAt.Time),
+			})
+		}
+		resp["feeds"] = out
+	}
+
+	// gator doesn't store favicons or extract links, but clients expect the keys
+	if query.Has("favicons") {
+		resp["favicons"] = []any{}
+	}
+	if query.Has("links") {
+		resp["links"] = []any{}
+	}
+
+	if query.Has("items") {
+		if err := feverItems(r, s, user, resp); err != nil {
+			return err
+		}
+	}
+
+	if query.Has("unread_item_ids") {
+		if err := feverUnreadItemIDs(ctx, s, user, resp); err != nil {
+			return err
+		}
+	}
+	if query.Has("saved_item_ids") {
+		if err := feverSavedItemIDs(ctx, s, user, resp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// feverGroups numbers the user's categories in sorted order, so a group keeps
+// its id as long as no category is added before it
+func feverGroups(feeds []database.GetFeverFeedsForUserRow) ([]feverGroup, []feverFeedsGroup) {
+	var categories []string
+	for _, feed := range feeds {
+		if feed.Category != "" && !slices.Contains(categories, feed.Category) {
+			categories = append(categories, feed.Category)
+		}
+	}
+	slices.Sort(categories)
+
+	groups := make([]feverGroup, 0, len(categories))
+	feedsGroups := make([]feverFeedsGroup, 0, len(categories))
+	for i, category := range categories {
+		var ids []int64
+		for _, feed := range feeds {
+			if feed.Category == category {
+				ids = append(ids, feed.FeverID)
+			}
+		}
+		groups = append(groups, feverGroup{ID: i + 1, Title: category})
+		feedsGroups = append(feedsGroups, feverFeedsGroup{GroupID: i + 1, FeedIDs: joinIDs(ids)})
+	}
+
+	return groups, feedsGroups
+}
+
+func feverItems(r *http.Request, s *state, user database.User, resp map[string]any) error {
+	query := r.URL.Query()
+	params := database.GetFeverItemsForUserParams{
+		UserID:   user.ID,
+		MaxItems: feverPageSize,
+	}
+
+	var err error
+	if params.SinceID, err = feverNullID(query, "since_id"); err != nil {
+		return err
+	}
+	if params.MaxID, err = feverNullID(query, "max_id"); err != nil {
+		return err
+	}
+	if v := query.Get("with_ids"); v != "" {
+		if params.WithIds, err = splitIDs(v); err != nil {
+			return err
+		}
+		if len(params.WithIds) > feverPageSize {
+			params.WithIds = params.WithIds[:feverPageSize]
+		}
+	}
+
+	items, err := s.db.GetFeverItemsForUser(r.Context(), params)
+	if err != nil {
+		return err
+	}
+	total, err := s.db.CountPostsForUser(r.Context(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	out := make([]feverItem, 0, len(items))
+	for _, item := range items {
+		out = append(out, feverItem{
+			ID:            item.FeverID,
+			FeedID:        item.FeedFeverID,
+			Title:         item.Title,
+			HTML:          item.Description,
+			URL:           item.Url,
+			IsSaved:       boolInt(item.IsSaved),
+			IsRead:        boolInt(item.IsRead),
+			CreatedOnTime: unixTime(item.PublishedAt),
+		})
+	}
+	resp["items"] = out
+	resp["total_items"] = total
+
+	return nil
+}
+
+func feverUnreadItemIDs(ctx context.Context, s *state, user database.User, resp map[string]any) error {
+	ids, err := s.db.GetUnreadFeverIDsForUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	resp["unread_item_ids"] = joinIDs(ids)
+	return nil
+}
+
+func feverSavedItemIDs(ctx context.Context, s *state, user database.User, resp map[string]any) error {
+	ids, err := s.db.GetSavedFeverIDsForUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	resp["saved_item_ids"] = joinIDs(ids)
+	return nil
+}
+
+// feverMark handles mark=item|feed|group with as=read|unread|saved|unsaved
+func feverMark(r *http.Request, s *state, user database.User, mark string, resp map[string]any) error {
+	ctx := r.Context()
+	as := r.FormValue("as")
+
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		return feverError("invalid id")
+	}
+
+	switch mark {
+	case "item":
+		post, err := s.db.GetPostByFeverID(ctx, id)
+		if err != nil {
+			return err
+		}
+		// only posts from the user's own feeds can be marked, except that
+		// saved items outlive the follow and can always be unsaved
+		if as == "unsaved" {
+			_, err = s.db.GetStarredPost(ctx, database.GetStarredPostParams{
+				PostID: post.ID,
+				UserID: user.ID,
+			})
+		} else {
+			_, err = s.db.GetFollowedPost(ctx, database.GetFollowedPostParams{
+				ID:     post.ID,
+				UserID: user.ID,
+			})
+		}
+		if err != nil {
+			return err
+		}
+		switch as {
+		case "read":
+			err = s.db.MarkPostRead(ctx, database.MarkPostReadParams{
+				UserID: user.ID,
+				PostID: post.ID,
+				ReadAt: sql.NullTime{Time: time.Now(), Valid: true},
+			})
+		case "unread":
+			err = s.db.MarkPostUnread(ctx, database.MarkPostUnreadParams{
+				UserID: user.ID,
+				PostID: post.ID,
+			})
+		case "saved", "unsaved":
+			starred := as == "saved"
+			err = s.db.SetPostStarred(ctx, database.SetPostStarredParams{
+				UserID:    user.ID,
+				PostID:    post.ID,
+				Starred:   starred,
+				StarredAt: sql.NullTime{Time: time.Now(), Valid: starred},
+			})
+			if err != nil {
+				return err
+			}
+			return feverSavedItemIDs(ctx, s, user, resp)
+		default:
+			return feverError("invalid as")
+		}
+		if err != nil {
+			return err
+		}
+		return feverUnreadItemIDs(ctx, s, user, resp)
+
+	case "feed", "group":
+		if as != "read" {
+			return feverError("invalid as")
+		}
+
+		params := database.MarkAllPostsReadParams{
+			UserID: user.ID,
+			ReadAt: sql.NullTime{Time: time.Now(), Valid: true},
+		}
+		// before is when the client last fetched items, so newer posts stay unread
+		if v := r.FormValue("before"); v != "" {
+			before, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return feverError("invalid before")
+			}
+			params.CreatedBefore = sql.NullTime{Time: time.Unix(before, 0), Valid: true}
+		}
+
+		if mark == "feed" {
+			feed, err := s.db.GetFeedByFeverID(ctx, id)
+			if err != nil {
+				return err
+			}
+			params.FeedID.UUID, params.FeedID.Valid = feed.ID, true
+		} else {
+			// group 0 is every feed and -1 the sparks, which gator doesn't have
+			if id < 0 {
+				return feverUnreadItemIDs(ctx, s, user, resp)
+			}
+			if id > 0 {
+				feeds, err := s.db.GetFeverFeedsForUser(ctx, user.ID)
+				if err != nil {
+					return err
+				}
+				groups, _ := feverGroups(feeds)
+				if id > int64(len(groups)) {
+					return sql.ErrNoRows
+				}
+				params.Category = nullString(groups[id-1].Title)
+			}
+		}
+
+		if _, err := s.db.MarkAllPostsRead(ctx, params); err != nil {
+			return err
+		}
+		return feverUnreadItemIDs(ctx, s, user, resp)
+
+	default:
+		return feverError("invalid mark")
+	}
+}
+
+func feverNullID(query url.Values, name string) (sql.NullInt64, error) {
+	v := query.Get(name)
+	if v == "" {
+		return sql.NullInt64{}, nil
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return sql.NullInt64{}, feverError("invalid " + name)
+	}
+	return sql.NullInt64{Int64: id, Valid: true}, nil
+}
+
+func splitIDs(s string) ([]int64, error) {
+	var ids []int64
+	for _, field := range strings.Split(s, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+		if err != nil {
+			return nil, feverError("invalid id list")
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func joinIDs(ids []int64) string {
+	fields := make([]string, 0, len(ids))
+	for _, id := range ids {
+		fields = append(fields, strconv.FormatInt(id, 10))
+	}
+	return strings.Join(fields, ",")
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// unixTime reports the zero time as 0 rather than a large negative number
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// feverResponse is the part of a Fever reply the tests look at
+type feverResponse struct {
+	Auth          int         `json:"auth"`
+	Feeds         []feverFeed `json:"feeds"`
+	Items         []feverItem `json:"items"`
+	TotalItems    int64       `json:"total_items"`
+	UnreadItemIDs string      `json:"unread_item_ids"`
+	SavedItemIDs  string      `json:"saved_item_ids"`
+}
+
+func TestFeverPassword(t *testing.T) {
+	s := newTestState(t)
+	registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"), testItem(2, "Two", "second"))
+	addFeed(t, s, "Example", fs)
+
+	srv := httptest.NewServer(newRouter(s))
+	defer srv.Close()
+
+	fever := func(query string, form url.Values) feverResponse {
+		t.Helper()
+		resp, err := http.PostForm(srv.URL+"/fever/?api&"+query, form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("fever %s: status %d", query, resp.StatusCode)
+		}
+		var out feverResponse
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	key := url.Values{"api_key": {feverAPIKey("alice", "pass")}}
+
+	if got := fever("feeds", key); got.Auth != 0 {
+		t.Fatal("fever access is enabled before a password is set")
+	}
+
+	setStdin(t, "pass\npass\n")
+	out := mustRun(t, s, "fever-password")
+	if !strings.Contains(out, "Fever access enabled for alice") {
+		t.Errorf("unexpected fever-password output:\n%s", out)
+	}
+
+	got := fever("feeds&items", key)
+	if got.Auth != 1 {
+		t.Fatal("the fever key was not accepted")
+	}
+	if len(got.Feeds) != 1 || got.Feeds[0].Title != "Example" {
+		t.Errorf("unexpected feeds: %+v", got.Feeds)
+	}
+	if len(got.Items) != 2 || got.TotalItems != 2 {
+		t.Fatalf("unexpected items: %+v", got.Items)
+	}
+
+	item := strconv.FormatInt(got.Items[0].ID, 10)
+	marked := fever("", url.Values{"api_key": key["api_key"], "mark": {"item"}, "as": {"read"}, "id": {item}})
+	if strings.Contains(marked.UnreadItemIDs, item) || marked.UnreadItemIDs == "" {
+		t.Errorf("unexpected unread ids after marking %s read: %q", item, marked.UnreadItemIDs)
+	}
+	saved := fever("", url.Values{"api_key": key["api_key"], "mark": {"item"}, "as": {"saved"}, "id": {item}})
+	if saved.SavedItemIDs != item {
+		t.Errorf("unexpected saved ids: %q", saved.SavedItemIDs)
+	}
+	// saved items can still be unsaved after unfollowing their feed
+	mustRun(t, s, "unfollow", fs.URL)
+	unsaved := fever("", url.Values{"api_key": key["api_key"], "mark": {"item"}, "as": {"unsaved"}, "id": {item}})
+	if unsaved.SavedItemIDs != "" {
+		t.Errorf("unexpected saved ids after unsaving: %q", unsaved.SavedItemIDs)
+	}
+
+	// an empty password turns fever access off again
+	setStdin(t, "\n")
+	out = mustRun(t, s, "fever-password")
+	if !strings.Contains(out, "Fever access disabled for alice") {
+		t.Errorf("unexpected fever-password output:\n%s", out)
+	}
+	if got := fever("feeds", key); got.Auth != 0 {
+		t.Error("the fever key still works after disabling access")
+	}
+
+	// items from feeds the user doesn't follow can't be marked
+	registerUser(t, s, "bob")
+	setStdin(t, "pass\npass\n")
+	mustRun(t, s, "fever-password")
+	resp, err := http.PostForm(srv.URL+"/fever/?api", url.Values{
+		"api_key": {feverAPIKey("bob", "pass")}, "mark": {"item"}, "as": {"saved"}, "id": {item},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("bob saved alice's item: status %d", resp.StatusCode)
+	}
+}
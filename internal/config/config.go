@@ -2,7 +2,9 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
@@ -12,10 +14,25 @@ import (
 type Config struct {
 	DBUrl string `json:"db_url"`
 	User  string `json:"user"`
+	// SessionToken proves who User is; the name alone is only for display
+	SessionToken string `json:"session_token,omitempty"`
+	// BaseURL is where serve can be reached, which published feeds link to
+	BaseURL string `json:"base_url,omitempty"`
+	// Retention is the default for feeds without retention of their own
+	Retention Retention `json:"retention"`
 }
 
-func (c *Config) SetUser(user string) error {
+// Retention limits how many posts prune keeps per feed; 0 means no limit
+type Retention struct {
+	MaxAgeDays int32 `json:"max_age_days,omitempty"`
+	MaxPosts   int32 `json:"max_posts,omitempty"`
+	// AfterAgg prunes at the end of every agg cycle
+	AfterAgg bool `json:"after_agg,omitempty"`
+}
+
+func (c *Config) SetSession(user, token string) error {
 	c.User = user
+	c.SessionToken = token
 	err := write(*c)
 	return err
 }
@@ -42,7 +59,8 @@ func getConfigFilePath() (string, error) {
 		return "", err
 	}
 	fp := filepath.Join(homeDir, configFileName)
-	fmt.Println("Config file path:", fp) // Debugging line
+	// stderr, so commands writing a document to stdout stay redirectable
+	fmt.Fprintln(os.Stderr, "Config file path:", fp)
 	return fp, nil
 }
 
@@ -55,5 +73,10 @@ func write(cfg Config) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(fp, b, 0644)
+	// the file holds the session token, so only its owner may read it.
+	// WriteFile keeps the mode of an existing file, so tighten that first.
+	if err := os.Chmod(fp, 0600); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.WriteFile(fp, b, 0600)
 }
@@ -14,17 +14,18 @@ import (
 
 const createFeedFollow = `-- name: CreateFeedFollow :one
 WITH inserted_feed_follow AS (
-    INSERT INTO feed_follows (id, created_at, user_id, feed_id)
+    INSERT INTO feed_follows (id, created_at, user_id, feed_id, category)
     VALUES (
         $1,
         $2,
         $3,
-        $4
+        $4,
+        $5
     )
-    RETURNING id, created_at, user_id, feed_id
+    RETURNING id, created_at, user_id, feed_id, category
 )
 SELECT
-    inserted_feed_follow.id, inserted_feed_follow.created_at, inserted_feed_follow.user_id, inserted_feed_follow.feed_id,
+    inserted_feed_follow.id, inserted_feed_follow.created_at, inserted_feed_follow.user_id, inserted_feed_follow.feed_id, inserted_feed_follow.category,
     feeds.name AS feed_name,
     users.name AS user_name
 FROM inserted_feed_follow
@@ -37,6 +38,7 @@ type CreateFeedFollowParams struct {
 	CreatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Category  string
 }
 
 type CreateFeedFollowRow struct {
@@ -44,6 +46,7 @@ type CreateFeedFollowRow struct {
 	CreatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Category  string
 	FeedName  string
 	UserName  string
 }
@@ -54,6 +57,7 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 		arg.CreatedAt,
 		arg.UserID,
 		arg.FeedID,
+		arg.Category,
 	)
 	var i CreateFeedFollowRow
 	err := row.Scan(
@@ -61,6 +65,7 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 		&i.CreatedAt,
 		&i.UserID,
 		&i.FeedID,
+		&i.Category,
 		&i.FeedName,
 		&i.UserName,
 	)
@@ -69,16 +74,18 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
 WITH feed_follows AS (
-    SELECT id, created_at, user_id, feed_id FROM feed_follows
+    SELECT id, created_at, user_id, feed_id, category FROM feed_follows
     WHERE feed_follows.user_id = $1
 )
 SELECT
-    feed_follows.id, feed_follows.created_at, feed_follows.user_id, feed_follows.feed_id,
+    feed_follows.id, feed_follows.created_at, feed_follows.user_id, feed_follows.feed_id, feed_follows.category,
     feeds.name AS feed_name,
+    feeds.url AS feed_url,
     users.name AS user_name
 FROM feed_follows
 INNER JOIN feeds ON feed_follows.feed_id = feeds.id
 INNER JOIN users ON feed_follows.user_id = users.id
+ORDER BY feed_follows.category, feeds.name
 `
 
 type GetFeedFollowsForUserRow struct {
@@ -86,7 +93,9 @@ type GetFeedFollowsForUserRow struct {
 	CreatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Category  string
 	FeedName  string
+	FeedUrl   string
 	UserName  string
 }
 
@@ -104,7 +113,9 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 			&i.CreatedAt,
 			&i.UserID,
 			&i.FeedID,
+			&i.Category,
 			&i.FeedName,
+			&i.FeedUrl,
 			&i.UserName,
 		); err != nil {
 			return nil, err
@@ -23,7 +23,7 @@ VALUES (
     $5,
     $6
 )
-RETURNING id, name, url, created_at, updated_at, user_id, last_fetched_at
+RETURNING id, name, url, created_at, updated_at, user_id, last_fetched_at, etag, last_modified, error_count, last_error, last_error_at, fever_id, retention_max_age_days, retention_max_posts
 `
 
 type CreateFeedParams struct {
@@ -53,12 +53,20 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ErrorCount,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.FeverID,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
 	)
 	return i, err
 }
 
 const getFeed = `-- name: GetFeed :one
-SELECT id, name, url, created_at, updated_at, user_id, last_fetched_at FROM feeds
+SELECT id, name, url, created_at, updated_at, user_id, last_fetched_at, etag, last_modified, error_count, last_error, last_error_at, fever_id, retention_max_age_days, retention_max_posts FROM feeds
 WHERE url = $1
 `
 
@@ -73,12 +81,48 @@ func (q *Queries) GetFeed(ctx context.Context, url string) (Feed, error) {
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ErrorCount,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.FeverID,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
+	)
+	return i, err
+}
+
+const getFeedById = `-- name: GetFeedById :one
+SELECT id, name, url, created_at, updated_at, user_id, last_fetched_at, etag, last_modified, error_count, last_error, last_error_at, fever_id, retention_max_age_days, retention_max_posts FROM feeds
+WHERE id = $1
+`
+
+func (q *Queries) GetFeedById(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedById, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Url,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ErrorCount,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.FeverID,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, name, url, created_at, updated_at, user_id, last_fetched_at FROM feeds
+SELECT id, name, url, created_at, updated_at, user_id, last_fetched_at, etag, last_modified, error_count, last_error, last_error_at, fever_id, retention_max_age_days, retention_max_posts FROM feeds
 `
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
@@ -98,6 +142,14 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.UpdatedAt,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.ErrorCount,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.FeverID,
+			&i.RetentionMaxAgeDays,
+			&i.RetentionMaxPosts,
 		); err != nil {
 			return nil, err
 		}
@@ -112,40 +164,140 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, name, url, created_at, updated_at, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1
+const getNextFeedsToFetch = `-- name: GetNextFeedsToFetch :many
+UPDATE feeds
+SET last_fetched_at = $1
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE (last_fetched_at IS NULL OR last_fetched_at < $1)
+    AND (
+        error_count = 0
+        OR last_error_at + INTERVAL '1 minute' * (1 << LEAST(error_count - 1, 10)) < $1
+    )
+    ORDER BY last_fetched_at ASC NULLS FIRST
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, name, url, created_at, updated_at, user_id, last_fetched_at, etag, last_modified, error_count, last_error, last_error_at, fever_id, retention_max_age_days, retention_max_posts
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
-	var i Feed
-	err := row.Scan(
-		&i.ID,
-		&i.Name,
-		&i.Url,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.UserID,
-		&i.LastFetchedAt,
-	)
-	return i, err
+type GetNextFeedsToFetchParams struct {
+	LastFetchedAt sql.NullTime
+	Limit         int32
+}
+
+// claims a batch of stale feeds by stamping last_fetched_at, skipping rows
+// another worker has locked so no feed is fetched twice. Failing feeds back
+// off exponentially: 1m, 2m, 4m, ... capped at ~17h.
+func (q *Queries) GetNextFeedsToFetch(ctx context.Context, arg GetNextFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getNextFeedsToFetch, arg.LastFetchedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Url,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.ErrorCount,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.FeverID,
+			&i.RetentionMaxAgeDays,
+			&i.RetentionMaxPosts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markFeedFailed = `-- name: MarkFeedFailed :exec
+UPDATE feeds
+SET last_fetched_at = $2,
+    error_count = error_count + 1,
+    last_error = $3,
+    last_error_at = $2
+WHERE id = $1
+`
+
+type MarkFeedFailedParams struct {
+	ID            uuid.UUID
+	LastFetchedAt sql.NullTime
+	LastError     sql.NullString
+}
+
+func (q *Queries) MarkFeedFailed(ctx context.Context, arg MarkFeedFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markFeedFailed, arg.ID, arg.LastFetchedAt, arg.LastError)
+	return err
 }
 
 const markFeedFetched = `-- name: MarkFeedFetched :exec
 UPDATE feeds
 SET last_fetched_at = $2,
-    updated_at = $2
+    updated_at = $2,
+    etag = $3,
+    last_modified = $4,
+    error_count = 0,
+    last_error = NULL,
+    last_error_at = NULL
 WHERE id = $1
 `
 
 type MarkFeedFetchedParams struct {
 	ID            uuid.UUID
 	LastFetchedAt sql.NullTime
+	Etag          sql.NullString
+	LastModified  sql.NullString
 }
 
 func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) error {
-	_, err := q.db.ExecContext(ctx, markFeedFetched, arg.ID, arg.LastFetchedAt)
+	_, err := q.db.ExecContext(ctx, markFeedFetched,
+		arg.ID,
+		arg.LastFetchedAt,
+		arg.Etag,
+		arg.LastModified,
+	)
+	return err
+}
+
+const setFeedRetention = `-- name: SetFeedRetention :exec
+UPDATE feeds
+SET retention_max_age_days = $2,
+    retention_max_posts = $3,
+    updated_at = $4
+WHERE id = $1
+`
+
+type SetFeedRetentionParams struct {
+	ID                  uuid.UUID
+	RetentionMaxAgeDays sql.NullInt32
+	RetentionMaxPosts   sql.NullInt32
+	UpdatedAt           time.Time
+}
+
+func (q *Queries) SetFeedRetention(ctx context.Context, arg SetFeedRetentionParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedRetention,
+		arg.ID,
+		arg.RetentionMaxAgeDays,
+		arg.RetentionMaxPosts,
+		arg.UpdatedAt,
+	)
 	return err
 }
@@ -0,0 +1,315 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: fever.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const countPostsForUser = `-- name: CountPostsForUser :one
+SELECT COUNT(*) FROM feed_follows
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = $1
+`
+
+func (q *Queries) CountPostsForUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPostsForUser, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const getFeedByFeverID = `-- name: GetFeedByFeverID :one
+SELECT id, name, url, created_at, updated_at, user_id, last_fetched_at, etag, last_modified, error_count, last_error, last_error_at, fever_id, retention_max_age_days, retention_max_posts FROM feeds
+WHERE fever_id = $1
+`
+
+func (q *Queries) GetFeedByFeverID(ctx context.Context, feverID int64) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByFeverID, feverID)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Url,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ErrorCount,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.FeverID,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
+	)
+	return i, err
+}
+
+const getFeverFeedsForUser = `-- name: GetFeverFeedsForUser :many
+SELECT
+    feeds.fever_id,
+    feeds.name,
+    feeds.url,
+    feeds.last_fetched_at,
+    feed_follows.category
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = $1
+ORDER BY feeds.name
+`
+
+type GetFeverFeedsForUserRow struct {
+	FeverID       int64
+	Name          string
+	Url           string
+	LastFetchedAt sql.NullTime
+	Category      string
+}
+
+func (q *Queries) GetFeverFeedsForUser(ctx context.Context, userID uuid.UUID) ([]GetFeverFeedsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFeverFeedsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFeverFeedsForUserRow
+	for rows.Next() {
+		var i GetFeverFeedsForUserRow
+		if err := rows.Scan(
+			&i.FeverID,
+			&i.Name,
+			&i.Url,
+			&i.LastFetchedAt,
+			&i.Category,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFeverItemsForUser = `-- name: GetFeverItemsForUser :many
+SELECT
+    posts.id,
+    posts.fever_id,
+    feeds.fever_id AS feed_fever_id,
+    posts.title,
+    posts.url,
+    posts.description,
+    posts.published_at,
+    COALESCE(post_states.read, FALSE)::BOOLEAN AS is_read,
+    COALESCE(post_states.starred, FALSE)::BOOLEAN AS is_saved
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND ($2::BIGINT IS NULL OR posts.fever_id > $2)
+AND ($3::BIGINT IS NULL OR posts.fever_id < $3)
+AND (COALESCE(CARDINALITY($4::BIGINT[]), 0) = 0 OR posts.fever_id = ANY($4::BIGINT[]))
+ORDER BY
+    CASE WHEN $3::BIGINT IS NULL THEN posts.fever_id END ASC,
+    posts.fever_id DESC
+LIMIT $5
+`
+
+type GetFeverItemsForUserParams struct {
+	UserID   uuid.UUID
+	SinceID  sql.NullInt64
+	MaxID    sql.NullInt64
+	WithIds  []int64
+	MaxItems int32
+}
+
+type GetFeverItemsForUserRow struct {
+	ID          uuid.UUID
+	FeverID     int64
+	FeedFeverID int64
+	Title       string
+	Url         string
+	Description string
+	PublishedAt time.Time
+	IsRead      bool
+	IsSaved     bool
+}
+
+// pages forward from since_id, or backward from max_id when it is given
+func (q *Queries) GetFeverItemsForUser(ctx context.Context, arg GetFeverItemsForUserParams) ([]GetFeverItemsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFeverItemsForUser,
+		arg.UserID,
+		arg.SinceID,
+		arg.MaxID,
+		pq.Array(arg.WithIds),
+		arg.MaxItems,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFeverItemsForUserRow
+	for rows.Next() {
+		var i GetFeverItemsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.FeverID,
+			&i.FeedFeverID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.IsRead,
+			&i.IsSaved,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostByFeverID = `-- name: GetPostByFeverID :one
+SELECT id, title, url, description, created_at, updated_at, published_at, feed_id, guid, content_hash, search, fever_id FROM posts
+WHERE fever_id = $1
+`
+
+func (q *Queries) GetPostByFeverID(ctx context.Context, feverID int64) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPostByFeverID, feverID)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.Search,
+		&i.FeverID,
+	)
+	return i, err
+}
+
+const getSavedFeverIDsForUser = `-- name: GetSavedFeverIDsForUser :many
+SELECT posts.fever_id FROM post_states
+INNER JOIN posts ON post_states.post_id = posts.id
+WHERE post_states.user_id = $1 AND post_states.starred
+ORDER BY posts.fever_id
+`
+
+func (q *Queries) GetSavedFeverIDsForUser(ctx context.Context, userID uuid.UUID) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, getSavedFeverIDsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var fever_id int64
+		if err := rows.Scan(&fever_id); err != nil {
+			return nil, err
+		}
+		items = append(items, fever_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnreadFeverIDsForUser = `-- name: GetUnreadFeverIDsForUser :many
+SELECT posts.fever_id FROM feed_follows
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1 AND post_states.read IS NOT TRUE
+ORDER BY posts.fever_id
+`
+
+func (q *Queries) GetUnreadFeverIDsForUser(ctx context.Context, userID uuid.UUID) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, getUnreadFeverIDsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var fever_id int64
+		if err := rows.Scan(&fever_id); err != nil {
+			return nil, err
+		}
+		items = append(items, fever_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserByFeverKey = `-- name: GetUserByFeverKey :one
+SELECT id, name, created_at, updated_at, api_key_hash, password_hash, fever_api_key FROM users
+WHERE fever_api_key = $1
+`
+
+func (q *Queries) GetUserByFeverKey(ctx context.Context, feverApiKey sql.NullString) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByFeverKey, feverApiKey)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ApiKeyHash,
+		&i.PasswordHash,
+		&i.FeverApiKey,
+	)
+	return i, err
+}
+
+const setUserFeverKey = `-- name: SetUserFeverKey :exec
+UPDATE users
+SET fever_api_key = $2,
+    updated_at = $3
+WHERE id = $1
+`
+
+type SetUserFeverKeyParams struct {
+	ID          uuid.UUID
+	FeverApiKey sql.NullString
+	UpdatedAt   time.Time
+}
+
+func (q *Queries) SetUserFeverKey(ctx context.Context, arg SetUserFeverKeyParams) error {
+	_, err := q.db.ExecContext(ctx, setUserFeverKey, arg.ID, arg.FeverApiKey, arg.UpdatedAt)
+	return err
+}
@@ -12,13 +12,21 @@ import (
 )
 
 type Feed struct {
-	ID            uuid.UUID
-	Name          string
-	Url           string
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                  uuid.UUID
+	Name                string
+	Url                 string
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	UserID              uuid.UUID
+	LastFetchedAt       sql.NullTime
+	Etag                sql.NullString
+	LastModified        sql.NullString
+	ErrorCount          int32
+	LastError           sql.NullString
+	LastErrorAt         sql.NullTime
+	FeverID             int64
+	RetentionMaxAgeDays sql.NullInt32
+	RetentionMaxPosts   sql.NullInt32
 }
 
 type FeedFollow struct {
@@ -26,6 +34,7 @@ type FeedFollow struct {
 	CreatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Category  string
 }
 
 type Post struct {
@@ -37,11 +46,59 @@ type Post struct {
 	UpdatedAt   time.Time
 	PublishedAt time.Time
 	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	Search      interface{}
+	FeverID     int64
+}
+
+type PostState struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	Read      bool
+	ReadAt    sql.NullTime
+	Starred   bool
+	StarredAt sql.NullTime
+}
+
+type PrunedPost struct {
+	FeedID   uuid.UUID
+	Guid     string
+	PrunedAt time.Time
+}
+
+type Session struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
 }
 
 type User struct {
+	ID           uuid.UUID
+	Name         string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	ApiKeyHash   sql.NullString
+	PasswordHash sql.NullString
+	FeverApiKey  sql.NullString
+}
+
+type Webhook struct {
 	ID        uuid.UUID
-	Name      string
 	CreatedAt time.Time
-	UpdatedAt time.Time
+	UserID    uuid.UUID
+	FeedID    uuid.NullUUID
+	Url       string
+	Secret    string
+}
+
+type WebhookDelivery struct {
+	ID         uuid.UUID
+	WebhookID  uuid.UUID
+	PostID     uuid.UUID
+	Attempt    int32
+	StatusCode sql.NullInt32
+	Error      sql.NullString
+	CreatedAt  time.Time
 }
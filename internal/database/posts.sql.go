@@ -7,13 +7,42 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const adoptLegacyPostGUID = `-- name: AdoptLegacyPostGUID :exec
+UPDATE posts
+SET guid = $1
+WHERE posts.feed_id = $2
+    AND posts.guid = $3
+    AND posts.url = $3
+    AND posts.content_hash = ''
+    AND NOT EXISTS (
+        SELECT 1 FROM posts AS adopted
+        WHERE adopted.feed_id = $2 AND adopted.guid = $1
+    )
+`
+
+type AdoptLegacyPostGUIDParams struct {
+	Guid   string
+	FeedID uuid.UUID
+	Url    string
+}
+
+// posts stored before guids were tracked have their url as a placeholder guid
+// and no content hash. The first fetch that sees the item's real guid moves
+// the post onto it, so CreatePost updates it instead of storing a copy.
+func (q *Queries) AdoptLegacyPostGUID(ctx context.Context, arg AdoptLegacyPostGUIDParams) error {
+	_, err := q.db.ExecContext(ctx, adoptLegacyPostGUID, arg.Guid, arg.FeedID, arg.Url)
+	return err
+}
+
 const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, published_at, url, feed_id, title, description)
+INSERT INTO posts (id, created_at, updated_at, published_at, url, feed_id, title, description, guid, content_hash)
 VALUES (
     $1,
     $2,
@@ -22,9 +51,18 @@ VALUES (
     $5,
     $6,
     $7,
-    $8
+    $8,
+    $9,
+    $10
 )
-RETURNING id, title, url, description, created_at, updated_at, published_at, feed_id
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = excluded.title,
+    url = excluded.url,
+    description = excluded.description,
+    updated_at = excluded.updated_at,
+    content_hash = excluded.content_hash
+WHERE posts.content_hash <> excluded.content_hash
+RETURNING id, title, url, description, created_at, updated_at, published_at, feed_id, guid, content_hash, search, fever_id, (xmax = 0) AS inserted
 `
 
 type CreatePostParams struct {
@@ -36,9 +74,29 @@ type CreatePostParams struct {
 	FeedID      uuid.UUID
 	Title       string
 	Description string
+	Guid        string
+	ContentHash string
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
+type CreatePostRow struct {
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	Search      interface{}
+	FeverID     int64
+	Inserted    bool
+}
+
+// inserts a new post, or updates it in place when the item was edited since
+// it was last fetched. Unchanged items return no rows.
+func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (CreatePostRow, error) {
 	row := q.db.QueryRowContext(ctx, createPost,
 		arg.ID,
 		arg.CreatedAt,
@@ -48,7 +106,125 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		arg.FeedID,
 		arg.Title,
 		arg.Description,
+		arg.Guid,
+		arg.ContentHash,
+	)
+	var i CreatePostRow
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.Search,
+		&i.FeverID,
+		&i.Inserted,
+	)
+	return i, err
+}
+
+const deleteUnstarredPosts = `-- name: DeleteUnstarredPosts :many
+DELETE FROM posts
+WHERE id = ANY($1::uuid[])
+AND NOT EXISTS (
+    SELECT 1 FROM post_states
+    WHERE post_states.post_id = posts.id AND post_states.starred
+)
+RETURNING feed_id, guid
+`
+
+type DeleteUnstarredPostsRow struct {
+	FeedID uuid.UUID
+	Guid   string
+}
+
+// checks for stars again in case one was added since the posts were listed,
+// and returns the feed and guid of every deleted post
+func (q *Queries) DeleteUnstarredPosts(ctx context.Context, ids []uuid.UUID) ([]DeleteUnstarredPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, deleteUnstarredPosts, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DeleteUnstarredPostsRow
+	for rows.Next() {
+		var i DeleteUnstarredPostsRow
+		if err := rows.Scan(&i.FeedID, &i.Guid); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFollowedPost = `-- name: GetFollowedPost :one
+SELECT posts.id, posts.title, posts.url, posts.description, posts.created_at, posts.updated_at, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.search, posts.fever_id, feeds.name AS feed_name FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE posts.id = $1 AND feed_follows.user_id = $2
+`
+
+type GetFollowedPostParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+type GetFollowedPostRow struct {
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	Search      interface{}
+	FeverID     int64
+	FeedName    string
+}
+
+// returns no rows unless the user follows the post's feed
+func (q *Queries) GetFollowedPost(ctx context.Context, arg GetFollowedPostParams) (GetFollowedPostRow, error) {
+	row := q.db.QueryRowContext(ctx, getFollowedPost, arg.ID, arg.UserID)
+	var i GetFollowedPostRow
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.Search,
+		&i.FeverID,
+		&i.FeedName,
 	)
+	return i, err
+}
+
+const getPost = `-- name: GetPost :one
+SELECT id, title, url, description, created_at, updated_at, published_at, feed_id, guid, content_hash, search, fever_id FROM posts
+WHERE id = $1
+`
+
+func (q *Queries) GetPost(ctx context.Context, id uuid.UUID) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPost, id)
 	var i Post
 	err := row.Scan(
 		&i.ID,
@@ -59,30 +235,35 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.UpdatedAt,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.Search,
+		&i.FeverID,
 	)
 	return i, err
 }
 
 const getPostsForUser = `-- name: GetPostsForUser :many
 WITH feed_follows AS (
-    SELECT id, created_at, user_id, feed_id FROM feed_follows
+    SELECT id, created_at, user_id, feed_id, category FROM feed_follows
     WHERE feed_follows.user_id = $1
 )
 SELECT
     feeds.name AS feed_name,
     users.name AS user_name,
-    posts.id, posts.title, posts.url, posts.description, posts.created_at, posts.updated_at, posts.published_at, posts.feed_id
+    posts.id, posts.title, posts.url, posts.description, posts.created_at, posts.updated_at, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.search, posts.fever_id
 FROM feed_follows
 INNER JOIN feeds ON feed_follows.feed_id = feeds.id
 INNER JOIN users ON feed_follows.user_id = users.id
 INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
 ORDER BY posts.published_at DESC
-LIMIT $2
+LIMIT $2 OFFSET $3
 `
 
 type GetPostsForUserParams struct {
 	UserID uuid.UUID
 	Limit  int32
+	Offset int32
 }
 
 type GetPostsForUserRow struct {
@@ -96,10 +277,14 @@ type GetPostsForUserRow struct {
 	UpdatedAt   time.Time
 	PublishedAt time.Time
 	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	Search      interface{}
+	FeverID     int64
 }
 
 func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit, arg.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -118,6 +303,385 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.UpdatedAt,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.Guid,
+			&i.ContentHash,
+			&i.Search,
+			&i.FeverID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPrunablePosts = `-- name: GetPrunablePosts :many
+WITH limits AS (
+    SELECT
+        feeds.id AS feed_id,
+        COALESCE(feeds.retention_max_age_days, $1::int) AS max_age_days,
+        COALESCE(feeds.retention_max_posts, $2::int) AS max_posts
+    FROM feeds
+), candidates AS (
+    SELECT
+        posts.id,
+        posts.feed_id,
+        limits.max_age_days > 0
+            AND posts.published_at < $3::timestamp - INTERVAL '1 day' * limits.max_age_days AS expired,
+        limits.max_posts > 0
+            AND row_number() OVER (PARTITION BY posts.feed_id ORDER BY posts.published_at DESC, posts.id) > limits.max_posts AS over_limit
+    FROM posts
+    INNER JOIN limits ON limits.feed_id = posts.feed_id
+)
+SELECT
+    candidates.id,
+    candidates.feed_id,
+    feeds.name AS feed_name,
+    feeds.url AS feed_url
+FROM candidates
+INNER JOIN feeds ON feeds.id = candidates.feed_id
+WHERE (candidates.expired OR candidates.over_limit)
+AND NOT EXISTS (
+    SELECT 1 FROM post_states
+    WHERE post_states.post_id = candidates.id AND post_states.starred
+)
+AND (
+    candidates.expired
+    OR NOT EXISTS (
+        SELECT 1 FROM feed_follows
+        LEFT JOIN post_states ON post_states.post_id = candidates.id AND post_states.user_id = feed_follows.user_id
+        WHERE feed_follows.feed_id = candidates.feed_id AND post_states.read IS NOT TRUE
+    )
+)
+ORDER BY feeds.name
+`
+
+type GetPrunablePostsParams struct {
+	DefaultMaxAgeDays int32
+	DefaultMaxPosts   int32
+	Now               time.Time
+}
+
+type GetPrunablePostsRow struct {
+	ID       uuid.UUID
+	FeedID   uuid.UUID
+	FeedName string
+	FeedUrl  string
+}
+
+// lists the posts past their feed's retention: older than the max age, or
+// beyond the newest max posts. A feed's own limits override the defaults and
+// 0 means no limit. Starred posts are always kept, and so are posts a
+// follower hasn't read yet until they pass the max age.
+func (q *Queries) GetPrunablePosts(ctx context.Context, arg GetPrunablePostsParams) ([]GetPrunablePostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPrunablePosts, arg.DefaultMaxAgeDays, arg.DefaultMaxPosts, arg.Now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPrunablePostsRow
+	for rows.Next() {
+		var i GetPrunablePostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.FeedID,
+			&i.FeedName,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTimelineForUser = `-- name: GetTimelineForUser :many
+SELECT
+    feeds.name AS feed_name,
+    feeds.url AS feed_url,
+    posts.id, posts.title, posts.url, posts.description, posts.created_at, posts.updated_at, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.search, posts.fever_id
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = $1
+AND ($2::uuid IS NULL OR feed_follows.feed_id = $2)
+AND (
+    $3::text IS NULL
+    OR feed_follows.category = $3
+    OR feed_follows.category LIKE $3 || '/%'
+)
+ORDER BY posts.published_at DESC
+LIMIT $4
+`
+
+type GetTimelineForUserParams struct {
+	UserID   uuid.UUID
+	FeedID   uuid.NullUUID
+	Category sql.NullString
+	MaxPosts int32
+}
+
+type GetTimelineForUserRow struct {
+	FeedName    string
+	FeedUrl     string
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	Search      interface{}
+	FeverID     int64
+}
+
+// optionally narrowed to one followed feed, or to a category tag and the
+// folders nested below it
+func (q *Queries) GetTimelineForUser(ctx context.Context, arg GetTimelineForUserParams) ([]GetTimelineForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getTimelineForUser,
+		arg.UserID,
+		arg.FeedID,
+		arg.Category,
+		arg.MaxPosts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTimelineForUserRow
+	for rows.Next() {
+		var i GetTimelineForUserRow
+		if err := rows.Scan(
+			&i.FeedName,
+			&i.FeedUrl,
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+			&i.ContentHash,
+			&i.Search,
+			&i.FeverID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnreadPostsForUser = `-- name: GetUnreadPostsForUser :many
+WITH feed_follows AS (
+    SELECT id, created_at, user_id, feed_id, category FROM feed_follows
+    WHERE feed_follows.user_id = $1
+)
+SELECT
+    feeds.name AS feed_name,
+    users.name AS user_name,
+    posts.id, posts.title, posts.url, posts.description, posts.created_at, posts.updated_at, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.search, posts.fever_id
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN users ON feed_follows.user_id = users.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE post_states.read IS NOT TRUE
+ORDER BY posts.published_at DESC
+LIMIT $2
+`
+
+type GetUnreadPostsForUserParams struct {
+	UserID uuid.UUID
+	Limit  int32
+}
+
+type GetUnreadPostsForUserRow struct {
+	FeedName    string
+	UserName    string
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	Search      interface{}
+	FeverID     int64
+}
+
+func (q *Queries) GetUnreadPostsForUser(ctx context.Context, arg GetUnreadPostsForUserParams) ([]GetUnreadPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUnreadPostsForUser, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUnreadPostsForUserRow
+	for rows.Next() {
+		var i GetUnreadPostsForUserRow
+		if err := rows.Scan(
+			&i.FeedName,
+			&i.UserName,
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+			&i.ContentHash,
+			&i.Search,
+			&i.FeverID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isPostPruned = `-- name: IsPostPruned :one
+SELECT EXISTS (
+    SELECT 1 FROM pruned_posts
+    WHERE feed_id = $1 AND guid = $2
+)
+`
+
+type IsPostPrunedParams struct {
+	FeedID uuid.UUID
+	Guid   string
+}
+
+func (q *Queries) IsPostPruned(ctx context.Context, arg IsPostPrunedParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isPostPruned, arg.FeedID, arg.Guid)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const notifyNewPost = `-- name: NotifyNewPost :exec
+SELECT pg_notify('new_posts', $1::text)
+`
+
+func (q *Queries) NotifyNewPost(ctx context.Context, payload string) error {
+	_, err := q.db.ExecContext(ctx, notifyNewPost, payload)
+	return err
+}
+
+const recordPrunedPost = `-- name: RecordPrunedPost :exec
+INSERT INTO pruned_posts (feed_id, guid, pruned_at)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING
+`
+
+type RecordPrunedPostParams struct {
+	FeedID   uuid.UUID
+	Guid     string
+	PrunedAt time.Time
+}
+
+func (q *Queries) RecordPrunedPost(ctx context.Context, arg RecordPrunedPostParams) error {
+	_, err := q.db.ExecContext(ctx, recordPrunedPost, arg.FeedID, arg.Guid, arg.PrunedAt)
+	return err
+}
+
+const searchPostsForUser = `-- name: SearchPostsForUser :many
+SELECT
+    feeds.name AS feed_name,
+    posts.id, posts.title, posts.url, posts.description, posts.created_at, posts.updated_at, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.search, posts.fever_id,
+    ts_rank(posts.search, query)::REAL AS rank
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id,
+    websearch_to_tsquery('english', $1) AS query
+WHERE feed_follows.user_id = $2
+AND posts.search @@ query
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT $3
+`
+
+type SearchPostsForUserParams struct {
+	Query      string
+	UserID     uuid.UUID
+	MaxResults int32
+}
+
+type SearchPostsForUserRow struct {
+	FeedName    string
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	Search      interface{}
+	FeverID     int64
+	Rank        float32
+}
+
+// websearch_to_tsquery accepts "quoted phrases", -negation and OR
+func (q *Queries) SearchPostsForUser(ctx context.Context, arg SearchPostsForUserParams) ([]SearchPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPostsForUser, arg.Query, arg.UserID, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchPostsForUserRow
+	for rows.Next() {
+		var i SearchPostsForUserRow
+		if err := rows.Scan(
+			&i.FeedName,
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+			&i.ContentHash,
+			&i.Search,
+			&i.FeverID,
+			&i.Rank,
 		); err != nil {
 			return nil, err
 		}
@@ -0,0 +1,100 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+type Querier interface {
+	// posts stored before guids were tracked have their url as a placeholder guid
+	// and no content hash. The first fetch that sees the item's real guid moves
+	// the post onto it, so CreatePost updates it instead of storing a copy.
+	AdoptLegacyPostGUID(ctx context.Context, arg AdoptLegacyPostGUIDParams) error
+	CountPostsForUser(ctx context.Context, userID uuid.UUID) (int64, error)
+	CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error)
+	CreateFeedFollow(ctx context.Context, arg CreateFeedFollowParams) (CreateFeedFollowRow, error)
+	// inserts a new post, or updates it in place when the item was edited since
+	// it was last fetched. Unchanged items return no rows.
+	CreatePost(ctx context.Context, arg CreatePostParams) (CreatePostRow, error)
+	CreateSession(ctx context.Context, arg CreateSessionParams) error
+	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateWebhook(ctx context.Context, arg CreateWebhookParams) (Webhook, error)
+	CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) error
+	DeleteSession(ctx context.Context, tokenHash string) error
+	// signs the user out everywhere except the session given
+	DeleteSessionsForUser(ctx context.Context, arg DeleteSessionsForUserParams) (int64, error)
+	// checks for stars again in case one was added since the posts were listed,
+	// and returns the feed and guid of every deleted post
+	DeleteUnstarredPosts(ctx context.Context, ids []uuid.UUID) ([]DeleteUnstarredPostsRow, error)
+	DeleteUsers(ctx context.Context) error
+	DeleteWebhook(ctx context.Context, arg DeleteWebhookParams) (int64, error)
+	GetFeed(ctx context.Context, url string) (Feed, error)
+	GetFeedByFeverID(ctx context.Context, feverID int64) (Feed, error)
+	GetFeedById(ctx context.Context, id uuid.UUID) (Feed, error)
+	GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]GetFeedFollowsForUserRow, error)
+	GetFeeds(ctx context.Context) ([]Feed, error)
+	GetFeverFeedsForUser(ctx context.Context, userID uuid.UUID) ([]GetFeverFeedsForUserRow, error)
+	// pages forward from since_id, or backward from max_id when it is given
+	GetFeverItemsForUser(ctx context.Context, arg GetFeverItemsForUserParams) ([]GetFeverItemsForUserRow, error)
+	// returns no rows unless the user follows the post's feed
+	GetFollowedPost(ctx context.Context, arg GetFollowedPostParams) (GetFollowedPostRow, error)
+	GetLastWebhookDelivery(ctx context.Context, webhookID uuid.UUID) (WebhookDelivery, error)
+	// claims a batch of stale feeds by stamping last_fetched_at, skipping rows
+	// another worker has locked so no feed is fetched twice. Failing feeds back
+	// off exponentially: 1m, 2m, 4m, ... capped at ~17h.
+	GetNextFeedsToFetch(ctx context.Context, arg GetNextFeedsToFetchParams) ([]Feed, error)
+	GetPost(ctx context.Context, id uuid.UUID) (Post, error)
+	GetPostByFeverID(ctx context.Context, feverID int64) (Post, error)
+	GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error)
+	// lists the posts past their feed's retention: older than the max age, or
+	// beyond the newest max posts. A feed's own limits override the defaults and
+	// 0 means no limit. Starred posts are always kept, and so are posts a
+	// follower hasn't read yet until they pass the max age.
+	GetPrunablePosts(ctx context.Context, arg GetPrunablePostsParams) ([]GetPrunablePostsRow, error)
+	GetSavedFeverIDsForUser(ctx context.Context, userID uuid.UUID) ([]int64, error)
+	// finds a post the user starred, whether or not they still follow its feed
+	GetStarredPost(ctx context.Context, arg GetStarredPostParams) (Post, error)
+	// starred posts stay listed even after the user unfollows their feed
+	GetStarredPostsForUser(ctx context.Context, arg GetStarredPostsForUserParams) ([]GetStarredPostsForUserRow, error)
+	// optionally narrowed to one followed feed, or to a category tag and the
+	// folders nested below it
+	GetTimelineForUser(ctx context.Context, arg GetTimelineForUserParams) ([]GetTimelineForUserRow, error)
+	GetUnreadCountsForUser(ctx context.Context, userID uuid.UUID) ([]GetUnreadCountsForUserRow, error)
+	GetUnreadFeverIDsForUser(ctx context.Context, userID uuid.UUID) ([]int64, error)
+	GetUnreadPostsForUser(ctx context.Context, arg GetUnreadPostsForUserParams) ([]GetUnreadPostsForUserRow, error)
+	GetUserByAPIKey(ctx context.Context, apiKeyHash sql.NullString) (User, error)
+	GetUserByFeverKey(ctx context.Context, feverApiKey sql.NullString) (User, error)
+	GetUserById(ctx context.Context, id uuid.UUID) (User, error)
+	GetUserByName(ctx context.Context, name string) (User, error)
+	GetUserBySession(ctx context.Context, arg GetUserBySessionParams) (User, error)
+	GetUsers(ctx context.Context) ([]User, error)
+	// webhooks without a feed only fire for feeds their owner follows
+	GetWebhooksForFeed(ctx context.Context, feedID uuid.UUID) ([]Webhook, error)
+	GetWebhooksForUser(ctx context.Context, userID uuid.UUID) ([]GetWebhooksForUserRow, error)
+	IsPostPruned(ctx context.Context, arg IsPostPrunedParams) (bool, error)
+	// marks every post in the user's followed feeds read, optionally only those
+	// of one feed or category, or ingested before a point in time
+	MarkAllPostsRead(ctx context.Context, arg MarkAllPostsReadParams) (int64, error)
+	MarkFeedFailed(ctx context.Context, arg MarkFeedFailedParams) error
+	MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) error
+	MarkPostRead(ctx context.Context, arg MarkPostReadParams) error
+	MarkPostUnread(ctx context.Context, arg MarkPostUnreadParams) error
+	NotifyNewPost(ctx context.Context, payload string) error
+	RecordPrunedPost(ctx context.Context, arg RecordPrunedPostParams) error
+	RemoveFeedFollow(ctx context.Context, arg RemoveFeedFollowParams) error
+	// websearch_to_tsquery accepts "quoted phrases", -negation and OR
+	SearchPostsForUser(ctx context.Context, arg SearchPostsForUserParams) ([]SearchPostsForUserRow, error)
+	SetFeedRetention(ctx context.Context, arg SetFeedRetentionParams) error
+	SetPostStarred(ctx context.Context, arg SetPostStarredParams) error
+	SetUserAPIKey(ctx context.Context, arg SetUserAPIKeyParams) error
+	SetUserFeverKey(ctx context.Context, arg SetUserFeverKeyParams) error
+	SetUserPassword(ctx context.Context, arg SetUserPasswordParams) error
+}
+
+var _ Querier = (*Queries)(nil)
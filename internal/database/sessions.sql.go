@@ -0,0 +1,95 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: sessions.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createSession = `-- name: CreateSession :exec
+INSERT INTO sessions (token_hash, user_id, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+)
+`
+
+type CreateSessionParams struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) error {
+	_, err := q.db.ExecContext(ctx, createSession,
+		arg.TokenHash,
+		arg.UserID,
+		arg.CreatedAt,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const deleteSession = `-- name: DeleteSession :exec
+DELETE FROM sessions
+WHERE token_hash = $1
+`
+
+func (q *Queries) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, deleteSession, tokenHash)
+	return err
+}
+
+const deleteSessionsForUser = `-- name: DeleteSessionsForUser :execrows
+DELETE FROM sessions
+WHERE user_id = $1 AND token_hash <> $2
+`
+
+type DeleteSessionsForUserParams struct {
+	UserID    uuid.UUID
+	TokenHash string
+}
+
+// signs the user out everywhere except the session given
+func (q *Queries) DeleteSessionsForUser(ctx context.Context, arg DeleteSessionsForUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteSessionsForUser, arg.UserID, arg.TokenHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getUserBySession = `-- name: GetUserBySession :one
+SELECT users.id, users.name, users.created_at, users.updated_at, users.api_key_hash, users.password_hash, users.fever_api_key FROM sessions
+INNER JOIN users ON sessions.user_id = users.id
+WHERE sessions.token_hash = $1 AND sessions.expires_at > $2
+`
+
+type GetUserBySessionParams struct {
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+func (q *Queries) GetUserBySession(ctx context.Context, arg GetUserBySessionParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserBySession, arg.TokenHash, arg.ExpiresAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ApiKeyHash,
+		&i.PasswordHash,
+		&i.FeverApiKey,
+	)
+	return i, err
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Store is what gator's commands run against. Queries implements it for
+// Postgres; the sqlitedb package adapts its own queries to the same methods.
+type Store interface {
+	Querier
+
+	// InTx runs fn with queries bound to a single transaction, committing if
+	// fn returns nil and rolling back otherwise
+	InTx(ctx context.Context, fn func(q Querier) error) error
+}
+
+type sqlStore struct {
+	*Queries
+	db *sql.DB
+}
+
+// NewStore returns a Store backed by a Postgres connection pool
+func NewStore(db *sql.DB) Store {
+	return &sqlStore{
+		Queries: New(db),
+		db:      db,
+	}
+}
+
+func (s *sqlStore) InTx(ctx context.Context, fn func(q Querier) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	// a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	if err := fn(s.WithTx(tx)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -7,27 +7,32 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, name)
+INSERT INTO users (id, created_at, updated_at, name, api_key_hash, password_hash)
 VALUES (
     $1,
     $2,
     $3,
-    $4
+    $4,
+    $5,
+    $6
 )
-RETURNING id, name, created_at, updated_at
+RETURNING id, name, created_at, updated_at, api_key_hash, password_hash, fever_api_key
 `
 
 type CreateUserParams struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Name      string
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Name         string
+	ApiKeyHash   sql.NullString
+	PasswordHash sql.NullString
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
@@ -36,6 +41,8 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		arg.CreatedAt,
 		arg.UpdatedAt,
 		arg.Name,
+		arg.ApiKeyHash,
+		arg.PasswordHash,
 	)
 	var i User
 	err := row.Scan(
@@ -43,6 +50,9 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Name,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ApiKeyHash,
+		&i.PasswordHash,
+		&i.FeverApiKey,
 	)
 	return i, err
 }
@@ -56,8 +66,28 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 	return err
 }
 
+const getUserByAPIKey = `-- name: GetUserByAPIKey :one
+SELECT id, name, created_at, updated_at, api_key_hash, password_hash, fever_api_key FROM users
+WHERE api_key_hash = $1
+`
+
+func (q *Queries) GetUserByAPIKey(ctx context.Context, apiKeyHash sql.NullString) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByAPIKey, apiKeyHash)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ApiKeyHash,
+		&i.PasswordHash,
+		&i.FeverApiKey,
+	)
+	return i, err
+}
+
 const getUserById = `-- name: GetUserById :one
-SELECT id, name, created_at, updated_at FROM users
+SELECT id, name, created_at, updated_at, api_key_hash, password_hash, fever_api_key FROM users
 WHERE id = $1
 `
 
@@ -69,12 +99,15 @@ func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Name,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ApiKeyHash,
+		&i.PasswordHash,
+		&i.FeverApiKey,
 	)
 	return i, err
 }
 
 const getUserByName = `-- name: GetUserByName :one
-SELECT id, name, created_at, updated_at FROM users
+SELECT id, name, created_at, updated_at, api_key_hash, password_hash, fever_api_key FROM users
 WHERE name = $1
 `
 
@@ -86,12 +119,15 @@ func (q *Queries) GetUserByName(ctx context.Context, name string) (User, error)
 		&i.Name,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ApiKeyHash,
+		&i.PasswordHash,
+		&i.FeverApiKey,
 	)
 	return i, err
 }
 
 const getUsers = `-- name: GetUsers :many
-SELECT id, name, created_at, updated_at FROM users
+SELECT id, name, created_at, updated_at, api_key_hash, password_hash, fever_api_key FROM users
 `
 
 func (q *Queries) GetUsers(ctx context.Context) ([]User, error) {
@@ -108,6 +144,9 @@ func (q *Queries) GetUsers(ctx context.Context) ([]User, error) {
 			&i.Name,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.ApiKeyHash,
+			&i.PasswordHash,
+			&i.FeverApiKey,
 		); err != nil {
 			return nil, err
 		}
@@ -121,3 +160,39 @@ func (q *Queries) GetUsers(ctx context.Context) ([]User, error) {
 	}
 	return items, nil
 }
+
+const setUserAPIKey = `-- name: SetUserAPIKey :exec
+UPDATE users
+SET api_key_hash = $2,
+    updated_at = $3
+WHERE id = $1
+`
+
+type SetUserAPIKeyParams struct {
+	ID         uuid.UUID
+	ApiKeyHash sql.NullString
+	UpdatedAt  time.Time
+}
+
+func (q *Queries) SetUserAPIKey(ctx context.Context, arg SetUserAPIKeyParams) error {
+	_, err := q.db.ExecContext(ctx, setUserAPIKey, arg.ID, arg.ApiKeyHash, arg.UpdatedAt)
+	return err
+}
+
+const setUserPassword = `-- name: SetUserPassword :exec
+UPDATE users
+SET password_hash = $2,
+    updated_at = $3
+WHERE id = $1
+`
+
+type SetUserPasswordParams struct {
+	ID           uuid.UUID
+	PasswordHash sql.NullString
+	UpdatedAt    time.Time
+}
+
+func (q *Queries) SetUserPassword(ctx context.Context, arg SetUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, setUserPassword, arg.ID, arg.PasswordHash, arg.UpdatedAt)
+	return err
+}
@@ -0,0 +1,57 @@
+package database
+
+import "strings"
+
+// SearchTerm is a word or quoted phrase of a search query
+type SearchTerm struct {
+	Text string
+	// Exclude is set for -word, which results must not contain
+	Exclude bool
+	// Or joins the term to the one before it with OR instead of AND
+	Or bool
+}
+
+// ParseWebSearch splits query the way postgres' websearch_to_tsquery reads
+// it: "quoted phrases", -exclusions and the or keyword. Stores without
+// websearch_to_tsquery use it to build their own search.
+func ParseWebSearch(query string) []SearchTerm {
+	var terms []SearchTerm
+	or := false
+
+	for {
+		query = strings.TrimLeft(query, " \t\r\n")
+		if query == "" {
+			return terms
+		}
+
+		term := SearchTerm{Or: or}
+		if query[0] == '-' {
+			term.Exclude = true
+			query = query[1:]
+		}
+
+		if strings.HasPrefix(query, `"`) {
+			end := strings.IndexByte(query[1:], '"')
+			if end < 0 {
+				term.Text, query = query[1:], ""
+			} else {
+				term.Text, query = query[1:end+1], query[end+2:]
+			}
+		} else {
+			end := strings.IndexAny(query, " \t\r\n")
+			if end < 0 {
+				end = len(query)
+			}
+			term.Text, query = query[:end], query[end:]
+			if !term.Exclude && strings.EqualFold(term.Text, "or") {
+				or = true
+				continue
+			}
+		}
+
+		if strings.TrimSpace(term.Text) != "" {
+			terms = append(terms, term)
+			or = false
+		}
+	}
+}
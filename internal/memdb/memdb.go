@@ -0,0 +1,227 @@
+// Package memdb is an in-memory database.Store for tests. It enforces the
+// primary keys, unique constraints, foreign keys and cascades of sql/schema
+// and reports violations with postgres' error codes, so code under test sees
+// the same failures it would against a real database.
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/jsleep/blog_aggregator/internal/database"
+	"github.com/lib/pq"
+)
+
+type postStateKey struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+}
+
+type prunedPostKey struct {
+	FeedID uuid.UUID
+	Guid   string
+}
+
+// tables holds every row; values are copied in and out, never shared
+type tables struct {
+	users       map[uuid.UUID]database.User
+	sessions    map[string]database.Session
+	feeds       map[uuid.UUID]database.Feed
+	feedFollows map[uuid.UUID]database.FeedFollow
+	posts       map[uuid.UUID]database.Post
+	postStates  map[postStateKey]database.PostState
+	prunedPosts map[prunedPostKey]database.PrunedPost
+	webhooks    map[uuid.UUID]database.Webhook
+	deliveries  map[uuid.UUID]database.WebhookDelivery
+
+	// feedSeq and postSeq stand in for the fever_id BIGSERIALs
+	feedSeq int64
+	postSeq int64
+}
+
+func (t *tables) clone() *tables {
+	c := *t
+	c.users = maps.Clone(t.users)
+	c.sessions = maps.Clone(t.sessions)
+	c.feeds = maps.Clone(t.feeds)
+	c.feedFollows = maps.Clone(t.feedFollows)
+	c.posts = maps.Clone(t.posts)
+	c.postStates = maps.Clone(t.postStates)
+	c.prunedPosts = maps.Clone(t.prunedPosts)
+	c.webhooks = maps.Clone(t.webhooks)
+	c.deliveries = maps.Clone(t.deliveries)
+	return &c
+}
+
+// Store is safe for concurrent use. Queries run one at a time and a
+// transaction holds the store for its whole duration, so transactions are
+// serializable.
+type Store struct {
+	mu *sync.Mutex
+	// inTx is set on the Store handed to an InTx callback, which already holds mu
+	inTx bool
+	t    *tables
+}
+
+var _ database.Store = (*Store)(nil)
+
+// New returns an empty store, as if every migration had just been applied
+func New() *Store {
+	return &Store{
+		mu: &sync.Mutex{},
+		t: &tables{
+			users:       map[uuid.UUID]database.User{},
+			sessions:    map[string]database.Session{},
+			feeds:       map[uuid.UUID]database.Feed{},
+			feedFollows: map[uuid.UUID]database.FeedFollow{},
+			posts:       map[uuid.UUID]database.Post{},
+			postStates:  map[postStateKey]database.PostState{},
+			prunedPosts: map[prunedPostKey]database.PrunedPost{},
+			webhooks:    map[uuid.UUID]database.Webhook{},
+			deliveries:  map[uuid.UUID]database.WebhookDelivery{},
+		},
+	}
+}
+
+// lock guards a single query; inside a transaction mu is already held
+func (s *Store) lock() func() {
+	if s.inTx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// InTx runs fn with the store locked, restoring every table if fn fails.
+// Nested calls join the outer transaction.
+func (s *Store) InTx(ctx context.Context, fn func(q database.Querier) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := s.t.clone()
+	if err := fn(&Store{mu: s.mu, inTx: true, t: s.t}); err != nil {
+		*s.t = *saved
+		return err
+	}
+
+	return nil
+}
+
+// uniqueViolation and foreignKeyViolation mirror the errors lib/pq returns,
+// named after the constraints postgres generates for sql/schema
+func uniqueViolation(constraint string) error {
+	return &pq.Error{
+		Code:       "23505",
+		Message:    fmt.Sprintf("duplicate key value violates unique constraint %q", constraint),
+		Constraint: constraint,
+	}
+}
+
+func foreignKeyViolation(constraint string) error {
+	return &pq.Error{
+		Code:       "23503",
+		Message:    fmt.Sprintf("insert or update violates foreign key constraint %q", constraint),
+		Constraint: constraint,
+	}
+}
+
+// sameString compares nullable columns the way SQL does: NULL equals nothing
+func sameString(a, b sql.NullString) bool {
+	return a.Valid && b.Valid && a.String == b.String
+}
+
+// the delete helpers cascade like the ON DELETE CASCADE foreign keys
+
+func (t *tables) deleteUser(id uuid.UUID) {
+	delete(t.users, id)
+	for token, session := range t.sessions {
+		if session.UserID == id {
+			delete(t.sessions, token)
+		}
+	}
+	for feedID, feed := range t.feeds {
+		if feed.UserID == id {
+			t.deleteFeed(feedID)
+		}
+	}
+	for followID, follow := range t.feedFollows {
+		if follow.UserID == id {
+			delete(t.feedFollows, followID)
+		}
+	}
+	for key := range t.postStates {
+		if key.UserID == id {
+			delete(t.postStates, key)
+		}
+	}
+	for hookID, hook := range t.webhooks {
+		if hook.UserID == id {
+			t.deleteWebhook(hookID)
+		}
+	}
+}
+
+func (t *tables) deleteFeed(id uuid.UUID) {
+	delete(t.feeds, id)
+	for followID, follow := range t.feedFollows {
+		if follow.FeedID == id {
+			delete(t.feedFollows, followID)
+		}
+	}
+	for postID, post := range t.posts {
+		if post.FeedID == id {
+			t.deletePost(postID)
+		}
+	}
+	for key := range t.prunedPosts {
+		if key.FeedID == id {
+			delete(t.prunedPosts, key)
+		}
+	}
+	for hookID, hook := range t.webhooks {
+		if hook.FeedID.Valid && hook.FeedID.UUID == id {
+			t.deleteWebhook(hookID)
+		}
+	}
+}
+
+func (t *tables) deletePost(id uuid.UUID) {
+	delete(t.posts, id)
+	for key := range t.postStates {
+		if key.PostID == id {
+			delete(t.postStates, key)
+		}
+	}
+	for deliveryID, delivery := range t.deliveries {
+		if delivery.PostID == id {
+			delete(t.deliveries, deliveryID)
+		}
+	}
+}
+
+func (t *tables) deleteWebhook(id uuid.UUID) {
+	delete(t.webhooks, id)
+	for deliveryID, delivery := range t.deliveries {
+		if delivery.WebhookID == id {
+			delete(t.deliveries, deliveryID)
+		}
+	}
+}
+
+// follows reports whether userID follows feedID, returning the follow
+func (t *tables) follows(userID, feedID uuid.UUID) (database.FeedFollow, bool) {
+	for _, follow := range t.feedFollows {
+		if follow.UserID == userID && follow.FeedID == feedID {
+			return follow, true
+		}
+	}
+	return database.FeedFollow{}, false
+}
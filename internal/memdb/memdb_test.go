@@ -0,0 +1,200 @@
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jsleep/blog_aggregator/internal/database"
+	"github.com/lib/pq"
+)
+
+var ctx = context.Background()
+
+func pqCode(err error) pq.ErrorCode {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code
+	}
+	return ""
+}
+
+func createUser(t *testing.T, s *Store, name string) database.User {
+	t.Helper()
+	user, err := s.CreateUser(ctx, database.CreateUserParams{
+		ID:         uuid.New(),
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+		Name:       name,
+		ApiKeyHash: sql.NullString{String: "key-" + name, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func createFeed(t *testing.T, s database.Querier, user database.User, url string) database.Feed {
+	t.Helper()
+	feed, err := s.CreateFeed(ctx, database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      url,
+		Url:       url,
+		UserID:    user.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feed
+}
+
+func createPost(t *testing.T, s *Store, feed database.Feed, guid, hash string) (database.CreatePostRow, error) {
+	t.Helper()
+	return s.CreatePost(ctx, database.CreatePostParams{
+		ID:          uuid.New(),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+		PublishedAt: time.Now(),
+		Url:         "https://example.com/" + guid,
+		FeedID:      feed.ID,
+		Title:       guid,
+		Guid:        guid,
+		ContentHash: hash,
+	})
+}
+
+func TestUniqueConstraints(t *testing.T) {
+	s := New()
+	alice := createUser(t, s, "alice")
+
+	_, err := s.CreateUser(ctx, database.CreateUserParams{ID: uuid.New(), Name: "alice"})
+	if pqCode(err) != "23505" {
+		t.Errorf("duplicate user name: got %v", err)
+	}
+	_, err = s.CreateUser(ctx, database.CreateUserParams{ID: uuid.New(), Name: "bob", ApiKeyHash: alice.ApiKeyHash})
+	if pqCode(err) != "23505" {
+		t.Errorf("duplicate api key: got %v", err)
+	}
+	// NULL keys never collide
+	if _, err := s.CreateUser(ctx, database.CreateUserParams{ID: uuid.New(), Name: "carol"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateUser(ctx, database.CreateUserParams{ID: uuid.New(), Name: "dave"}); err != nil {
+		t.Errorf("two users without api keys: %v", err)
+	}
+
+	feed := createFeed(t, s, alice, "https://example.com/feed.xml")
+	_, err = s.CreateFeed(ctx, database.CreateFeedParams{ID: uuid.New(), Name: "other", Url: feed.Url, UserID: alice.ID})
+	if pqCode(err) != "23505" {
+		t.Errorf("duplicate feed url: got %v", err)
+	}
+
+	follow := database.CreateFeedFollowParams{ID: uuid.New(), UserID: alice.ID, FeedID: feed.ID}
+	if _, err := s.CreateFeedFollow(ctx, follow); err != nil {
+		t.Fatal(err)
+	}
+	follow.ID = uuid.New()
+	if _, err := s.CreateFeedFollow(ctx, follow); pqCode(err) != "23505" {
+		t.Errorf("duplicate follow: got %v", err)
+	}
+}
+
+func TestCreatePostUpsert(t *testing.T) {
+	s := New()
+	feed := createFeed(t, s, createUser(t, s, "alice"), "https://example.com/feed.xml")
+
+	created, err := createPost(t, s, feed, "one", "v1")
+	if err != nil || !created.Inserted {
+		t.Fatalf("first insert: %+v, %v", created, err)
+	}
+	if _, err := createPost(t, s, feed, "one", "v1"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unchanged post: got %v, want no rows", err)
+	}
+	updated, err := createPost(t, s, feed, "one", "v2")
+	if err != nil || updated.Inserted || updated.ID != created.ID || updated.FeverID != created.FeverID {
+		t.Errorf("changed post should update in place: %+v, %v", updated, err)
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	s := New()
+	missing := database.User{ID: uuid.New()}
+
+	_, err := s.CreateFeed(ctx, database.CreateFeedParams{ID: uuid.New(), Name: "x", Url: "x", UserID: missing.ID})
+	if pqCode(err) != "23503" {
+		t.Errorf("feed of a missing user: got %v", err)
+	}
+	if _, err := createPost(t, s, database.Feed{ID: uuid.New()}, "one", "v1"); pqCode(err) != "23503" {
+		t.Errorf("post of a missing feed: got %v", err)
+	}
+	err = s.CreateSession(ctx, database.CreateSessionParams{TokenHash: "t", UserID: missing.ID})
+	if pqCode(err) != "23503" {
+		t.Errorf("session of a missing user: got %v", err)
+	}
+}
+
+func TestDeleteUsersCascades(t *testing.T) {
+	s := New()
+	alice := createUser(t, s, "alice")
+	feed := createFeed(t, s, alice, "https://example.com/feed.xml")
+	post, err := createPost(t, s, feed, "one", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPostStarred(ctx, database.SetPostStarredParams{UserID: alice.ID, PostID: post.ID, Starred: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateWebhook(ctx, database.CreateWebhookParams{ID: uuid.New(), UserID: alice.ID, Url: "https://example.com/hook"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteUsers(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.t.feeds) != 0 || len(s.t.posts) != 0 || len(s.t.postStates) != 0 || len(s.t.webhooks) != 0 {
+		t.Errorf("rows left behind: %d feeds, %d posts, %d post states, %d webhooks",
+			len(s.t.feeds), len(s.t.posts), len(s.t.postStates), len(s.t.webhooks))
+	}
+	// sequences are not reset, like BIGSERIAL
+	next := createFeed(t, s, createUser(t, s, "bob"), "https://example.com/other.xml")
+	if next.FeverID <= feed.FeverID {
+		t.Errorf("fever id reused: %d after %d", next.FeverID, feed.FeverID)
+	}
+}
+
+func TestInTx(t *testing.T) {
+	s := New()
+	alice := createUser(t, s, "alice")
+
+	failed := errors.New("failed")
+	err := s.InTx(ctx, func(q database.Querier) error {
+		createFeed(t, q, alice, "https://example.com/feed.xml")
+		// nested transactions join the outer one
+		return q.(*Store).InTx(ctx, func(q database.Querier) error {
+			return failed
+		})
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("got %v, want the callback's error", err)
+	}
+	if _, err := s.GetFeed(ctx, "https://example.com/feed.xml"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("a rolled back feed is visible: %v", err)
+	}
+
+	err = s.InTx(ctx, func(q database.Querier) error {
+		createFeed(t, q, alice, "https://example.com/feed.xml")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetFeed(ctx, "https://example.com/feed.xml"); err != nil {
+		t.Errorf("a committed feed is missing: %v", err)
+	}
+}
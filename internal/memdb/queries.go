@@ -0,0 +1,1247 @@
+package memdb
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"database/sql"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+// Each method implements the query of the same name in sql/queries.
+
+// followedPost is a post joined to the follow that shows it to a user
+type followedPost struct {
+	post   database.Post
+	feed   database.Feed
+	follow database.FeedFollow
+}
+
+func (t *tables) followedPosts(userID uuid.UUID) []followedPost {
+	var rows []followedPost
+	for _, follow := range t.feedFollows {
+		if follow.UserID != userID {
+			continue
+		}
+		for _, post := range t.posts {
+			if post.FeedID == follow.FeedID {
+				rows = append(rows, followedPost{post: post, feed: t.feeds[post.FeedID], follow: follow})
+			}
+		}
+	}
+	return rows
+}
+
+func (t *tables) isRead(userID, postID uuid.UUID) bool {
+	return t.postStates[postStateKey{UserID: userID, PostID: postID}].Read
+}
+
+// byPublished orders newest first, like ORDER BY posts.published_at DESC
+func byPublished(a, b database.Post) int {
+	if c := b.PublishedAt.Compare(a.PublishedAt); c != 0 {
+		return c
+	}
+	return cmp.Compare(b.FeverID, a.FeverID)
+}
+
+// page applies LIMIT and OFFSET
+func page[T any](rows []T, limit, offset int32) []T {
+	if int(offset) >= len(rows) {
+		return nil
+	}
+	rows = rows[offset:]
+	if int(limit) < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+func byCreatedAt[T any](createdAt func(T) time.Time) func(a, b T) int {
+	return func(a, b T) int {
+		return createdAt(a).Compare(createdAt(b))
+	}
+}
+
+func (s *Store) AdoptLegacyPostGUID(ctx context.Context, arg database.AdoptLegacyPostGUIDParams) error {
+	defer s.lock()()
+
+	var legacy *database.Post
+	for _, post := range s.t.posts {
+		if post.FeedID != arg.FeedID {
+			continue
+		}
+		// NOT EXISTS: the guid is already taken
+		if post.Guid == arg.Guid {
+			return nil
+		}
+		if post.Guid == arg.Url && post.Url == arg.Url && post.ContentHash == "" {
+			legacy = &post
+		}
+	}
+	if legacy != nil {
+		legacy.Guid = arg.Guid
+		s.t.posts[legacy.ID] = *legacy
+	}
+	return nil
+}
+
+func (s *Store) CountPostsForUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	defer s.lock()()
+	return int64(len(s.t.followedPosts(userID))), nil
+}
+
+func (s *Store) CreateFeed(ctx context.Context, arg database.CreateFeedParams) (database.Feed, error) {
+	defer s.lock()()
+
+	if _, ok := s.t.users[arg.UserID]; !ok {
+		return database.Feed{}, foreignKeyViolation("feeds_user_id_fkey")
+	}
+	if _, ok := s.t.feeds[arg.ID]; ok {
+		return database.Feed{}, uniqueViolation("feeds_pkey")
+	}
+	for _, feed := range s.t.feeds {
+		if feed.Name == arg.Name {
+			return database.Feed{}, uniqueViolation("feeds_name_key")
+		}
+		if feed.Url == arg.Url {
+			return database.Feed{}, uniqueViolation("feeds_url_key")
+		}
+	}
+
+	s.t.feedSeq++
+	feed := database.Feed{
+		ID:        arg.ID,
+		Name:      arg.Name,
+		Url:       arg.Url,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		UserID:    arg.UserID,
+		FeverID:   s.t.feedSeq,
+	}
+	s.t.feeds[feed.ID] = feed
+	return feed, nil
+}
+
+func (s *Store) CreateFeedFollow(ctx context.Context, arg database.CreateFeedFollowParams) (database.CreateFeedFollowRow, error) {
+	defer s.lock()()
+
+	user, ok := s.t.users[arg.UserID]
+	if !ok {
+		return database.CreateFeedFollowRow{}, foreignKeyViolation("feed_follows_user_id_fkey")
+	}
+	feed, ok := s.t.feeds[arg.FeedID]
+	if !ok {
+		return database.CreateFeedFollowRow{}, foreignKeyViolation("feed_follows_feed_id_fkey")
+	}
+	if _, ok := s.t.feedFollows[arg.ID]; ok {
+		return database.CreateFeedFollowRow{}, uniqueViolation("feed_follows_pkey")
+	}
+	if _, ok := s.t.follows(arg.UserID, arg.FeedID); ok {
+		return database.CreateFeedFollowRow{}, uniqueViolation("feed_follows_user_id_feed_id_key")
+	}
+
+	s.t.feedFollows[arg.ID] = database.FeedFollow(arg)
+	return database.CreateFeedFollowRow{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UserID:    arg.UserID,
+		FeedID:    arg.FeedID,
+		Category:  arg.Category,
+		FeedName:  feed.Name,
+		UserName:  user.Name,
+	}, nil
+}
+
+func (s *Store) CreatePost(ctx context.Context, arg database.CreatePostParams) (database.CreatePostRow, error) {
+	defer s.lock()()
+
+	if _, ok := s.t.feeds[arg.FeedID]; !ok {
+		return database.CreatePostRow{}, foreignKeyViolation("posts_feed_id_fkey")
+	}
+
+	for _, post := range s.t.posts {
+		if post.FeedID != arg.FeedID || post.Guid != arg.Guid {
+			continue
+		}
+		// ON CONFLICT ... WHERE the content changed, otherwise no rows
+		if post.ContentHash == arg.ContentHash {
+			return database.CreatePostRow{}, sql.ErrNoRows
+		}
+		post.Title = arg.Title
+		post.Url = arg.Url
+		post.Description = arg.Description
+		post.UpdatedAt = arg.UpdatedAt
+		post.ContentHash = arg.ContentHash
+		s.t.posts[post.ID] = post
+		return createdPostRow(post, false), nil
+	}
+
+	if _, ok := s.t.posts[arg.ID]; ok {
+		return database.CreatePostRow{}, uniqueViolation("posts_pkey")
+	}
+
+	s.t.postSeq++
+	post := database.Post{
+		ID:          arg.ID,
+		Title:       arg.Title,
+		Url:         arg.Url,
+		Description: arg.Description,
+		CreatedAt:   arg.CreatedAt,
+		UpdatedAt:   arg.UpdatedAt,
+		PublishedAt: arg.PublishedAt,
+		FeedID:      arg.FeedID,
+		Guid:        arg.Guid,
+		ContentHash: arg.ContentHash,
+		FeverID:     s.t.postSeq,
+	}
+	s.t.posts[post.ID] = post
+	return createdPostRow(post, true), nil
+}
+
+func createdPostRow(post database.Post, inserted bool) database.CreatePostRow {
+	return database.CreatePostRow{
+		ID:          post.ID,
+		Title:       post.Title,
+		Url:         post.Url,
+		Description: post.Description,
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+		PublishedAt: post.PublishedAt,
+		FeedID:      post.FeedID,
+		Guid:        post.Guid,
+		ContentHash: post.ContentHash,
+		Search:      post.Search,
+		FeverID:     post.FeverID,
+		Inserted:    inserted,
+	}
+}
+
+func (s *Store) CreateSession(ctx context.Context, arg database.CreateSessionParams) error {
+	defer s.lock()()
+
+	if _, ok := s.t.users[arg.UserID]; !ok {
+		return foreignKeyViolation("sessions_user_id_fkey")
+	}
+	if _, ok := s.t.sessions[arg.TokenHash]; ok {
+		return uniqueViolation("sessions_pkey")
+	}
+
+	s.t.sessions[arg.TokenHash] = database.Session(arg)
+	return nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	defer s.lock()()
+
+	if _, ok := s.t.users[arg.ID]; ok {
+		return database.User{}, uniqueViolation("users_pkey")
+	}
+	for _, user := range s.t.users {
+		if user.Name == arg.Name {
+			return database.User{}, uniqueViolation("users_name_key")
+		}
+		if sameString(user.ApiKeyHash, arg.ApiKeyHash) {
+			return database.User{}, uniqueViolation("users_api_key_hash_key")
+		}
+	}
+
+	user := database.User{
+		ID:           arg.ID,
+		Name:         arg.Name,
+		CreatedAt:    arg.CreatedAt,
+		UpdatedAt:    arg.UpdatedAt,
+		ApiKeyHash:   arg.ApiKeyHash,
+		PasswordHash: arg.PasswordHash,
+	}
+	s.t.users[user.ID] = user
+	return user, nil
+}
+
+func (s *Store) CreateWebhook(ctx context.Context, arg database.CreateWebhookParams) (database.Webhook, error) {
+	defer s.lock()()
+
+	if _, ok := s.t.users[arg.UserID]; !ok {
+		return database.Webhook{}, foreignKeyViolation("webhooks_user_id_fkey")
+	}
+	if _, ok := s.t.feeds[arg.FeedID.UUID]; arg.FeedID.Valid && !ok {
+		return database.Webhook{}, foreignKeyViolation("webhooks_feed_id_fkey")
+	}
+	if _, ok := s.t.webhooks[arg.ID]; ok {
+		return database.Webhook{}, uniqueViolation("webhooks_pkey")
+	}
+
+	hook := database.Webhook(arg)
+	s.t.webhooks[hook.ID] = hook
+	return hook, nil
+}
+
+func (s *Store) CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) error {
+	defer s.lock()()
+
+	if _, ok := s.t.webhooks[arg.WebhookID]; !ok {
+		return foreignKeyViolation("webhook_deliveries_webhook_id_fkey")
+	}
+	if _, ok := s.t.posts[arg.PostID]; !ok {
+		return foreignKeyViolation("webhook_deliveries_post_id_fkey")
+	}
+	if _, ok := s.t.deliveries[arg.ID]; ok {
+		return uniqueViolation("webhook_deliveries_pkey")
+	}
+
+	s.t.deliveries[arg.ID] = database.WebhookDelivery(arg)
+	return nil
+}
+
+func (s *Store) DeleteSession(ctx context.Context, tokenHash string) error {
+	defer s.lock()()
+	delete(s.t.sessions, tokenHash)
+	return nil
+}
+
+func (s *Store) DeleteSessionsForUser(ctx context.Context, arg database.DeleteSessionsForUserParams) (int64, error) {
+	defer s.lock()()
+
+	var deleted int64
+	for token, session := range s.t.sessions {
+		if session.UserID == arg.UserID && token != arg.TokenHash {
+			delete(s.t.sessions, token)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Store) DeleteUnstarredPosts(ctx context.Context, ids []uuid.UUID) ([]database.DeleteUnstarredPostsRow, error) {
+	defer s.lock()()
+
+	var deleted []database.DeleteUnstarredPostsRow
+	for _, id := range ids {
+		post, ok := s.t.posts[id]
+		if !ok || s.t.isStarred(id) {
+			continue
+		}
+		s.t.deletePost(id)
+		deleted = append(deleted, database.DeleteUnstarredPostsRow{FeedID: post.FeedID, Guid: post.Guid})
+	}
+	return deleted, nil
+}
+
+func (s *Store) DeleteUsers(ctx context.Context) error {
+	defer s.lock()()
+	for id := range s.t.users {
+		s.t.deleteUser(id)
+	}
+	return nil
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, arg database.DeleteWebhookParams) (int64, error) {
+	defer s.lock()()
+
+	hook, ok := s.t.webhooks[arg.ID]
+	if !ok || hook.UserID != arg.UserID {
+		return 0, nil
+	}
+	s.t.deleteWebhook(arg.ID)
+	return 1, nil
+}
+
+func (s *Store) GetFeed(ctx context.Context, url string) (database.Feed, error) {
+	defer s.lock()()
+	for _, feed := range s.t.feeds {
+		if feed.Url == url {
+			return feed, nil
+		}
+	}
+	return database.Feed{}, sql.ErrNoRows
+}
+
+func (s *Store) GetFeedByFeverID(ctx context.Context, feverID int64) (database.Feed, error) {
+	defer s.lock()()
+	for _, feed := range s.t.feeds {
+		if feed.FeverID == feverID {
+			return feed, nil
+		}
+	}
+	return database.Feed{}, sql.ErrNoRows
+}
+
+func (s *Store) GetFeedById(ctx context.Context, id uuid.UUID) (database.Feed, error) {
+	defer s.lock()()
+	feed, ok := s.t.feeds[id]
+	if !ok {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	return feed, nil
+}
+
+func (s *Store) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetFeedFollowsForUserRow, error) {
+	defer s.lock()()
+
+	var rows []database.GetFeedFollowsForUserRow
+	for _, follow := range s.t.feedFollows {
+		if follow.UserID != userID {
+			continue
+		}
+		feed := s.t.feeds[follow.FeedID]
+		rows = append(rows, database.GetFeedFollowsForUserRow{
+			ID:        follow.ID,
+			CreatedAt: follow.CreatedAt,
+			UserID:    follow.UserID,
+			FeedID:    follow.FeedID,
+			Category:  follow.Category,
+			FeedName:  feed.Name,
+			FeedUrl:   feed.Url,
+			UserName:  s.t.users[follow.UserID].Name,
+		})
+	}
+	slices.SortFunc(rows, func(a, b database.GetFeedFollowsForUserRow) int {
+		return cmp.Or(cmp.Compare(a.Category, b.Category), cmp.Compare(a.FeedName, b.FeedName))
+	})
+	return rows, nil
+}
+
+func (s *Store) GetFeeds(ctx context.Context) ([]database.Feed, error) {
+	defer s.lock()()
+	feeds := slices.Collect(maps.Values(s.t.feeds))
+	slices.SortFunc(feeds, byCreatedAt(func(feed database.Feed) time.Time { return feed.CreatedAt }))
+	return feeds, nil
+}
+
+func (s *Store) GetFeverFeedsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetFeverFeedsForUserRow, error) {
+	defer s.lock()()
+
+	var rows []database.GetFeverFeedsForUserRow
+	for _, follow := range s.t.feedFollows {
+		if follow.UserID != userID {
+			continue
+		}
+		feed := s.t.feeds[follow.FeedID]
+		rows = append(rows, database.GetFeverFeedsForUserRow{
+			FeverID:       feed.FeverID,
+			Name:          feed.Name,
+			Url:           feed.Url,
+			LastFetchedAt: feed.LastFetchedAt,
+			Category:      follow.Category,
+		})
+	}
+	slices.SortFunc(rows, func(a, b database.GetFeverFeedsForUserRow) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return rows, nil
+}
+
+func (s *Store) GetFeverItemsForUser(ctx context.Context, arg database.GetFeverItemsForUserParams) ([]database.GetFeverItemsForUserRow, error) {
+	defer s.lock()()
+
+	var rows []database.GetFeverItemsForUserRow
+	for _, fp := range s.t.followedPosts(arg.UserID) {
+		if arg.SinceID.Valid && fp.post.FeverID <= arg.SinceID.Int64 {
+			continue
+		}
+		if arg.MaxID.Valid && fp.post.FeverID >= arg.MaxID.Int64 {
+			continue
+		}
+		if len(arg.WithIds) > 0 && !slices.Contains(arg.WithIds, fp.post.FeverID) {
+			continue
+		}
+		state := s.t.postStates[postStateKey{UserID: arg.UserID, PostID: fp.post.ID}]
+		rows = append(rows, database.GetFeverItemsForUserRow{
+			ID:          fp.post.ID,
+			FeverID:     fp.post.FeverID,
+			FeedFeverID: fp.feed.FeverID,
+			Title:       fp.post.Title,
+			Url:         fp.post.Url,
+			Description: fp.post.Description,
+			PublishedAt: fp.post.PublishedAt,
+			IsRead:      state.Read,
+			IsSaved:     state.Starred,
+		})
+	}
+
+	// forward from since_id, backward from max_id
+	slices.SortFunc(rows, func(a, b database.GetFeverItemsForUserRow) int {
+		if arg.MaxID.Valid {
+			return cmp.Compare(b.FeverID, a.FeverID)
+		}
+		return cmp.Compare(a.FeverID, b.FeverID)
+	})
+	return page(rows, arg.MaxItems, 0), nil
+}
+
+func (s *Store) GetFollowedPost(ctx context.Context, arg database.GetFollowedPostParams) (database.GetFollowedPostRow, error) {
+	defer s.lock()()
+
+	post, ok := s.t.posts[arg.ID]
+	if !ok {
+		return database.GetFollowedPostRow{}, sql.ErrNoRows
+	}
+	if _, ok := s.t.follows(arg.UserID, post.FeedID); !ok {
+		return database.GetFollowedPostRow{}, sql.ErrNoRows
+	}
+
+	return database.GetFollowedPostRow{
+		ID:          post.ID,
+		Title:       post.Title,
+		Url:         post.Url,
+		Description: post.Description,
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+		PublishedAt: post.PublishedAt,
+		FeedID:      post.FeedID,
+		Guid:        post.Guid,
+		ContentHash: post.ContentHash,
+		Search:      post.Search,
+		FeverID:     post.FeverID,
+		FeedName:    s.t.feeds[post.FeedID].Name,
+	}, nil
+}
+
+func (s *Store) GetLastWebhookDelivery(ctx context.Context, webhookID uuid.UUID) (database.WebhookDelivery, error) {
+	defer s.lock()()
+
+	var last database.WebhookDelivery
+	found := false
+	for _, delivery := range s.t.deliveries {
+		if delivery.WebhookID == webhookID && (!found || delivery.CreatedAt.After(last.CreatedAt)) {
+			last, found = delivery, true
+		}
+	}
+	if !found {
+		return database.WebhookDelivery{}, sql.ErrNoRows
+	}
+	return last, nil
+}
+
+func (s *Store) GetNextFeedsToFetch(ctx context.Context, arg database.GetNextFeedsToFetchParams) ([]database.Feed, error) {
+	defer s.lock()()
+
+	// a NULL comparison is never true, so a NULL argument claims nothing
+	if !arg.LastFetchedAt.Valid {
+		return nil, nil
+	}
+	now := arg.LastFetchedAt.Time
+
+	var due []database.Feed
+	for _, feed := range s.t.feeds {
+		if feed.LastFetchedAt.Valid && !feed.LastFetchedAt.Time.Before(now) {
+			continue
+		}
+		if feed.ErrorCount > 0 {
+			backoff := time.Minute << min(feed.ErrorCount-1, 10)
+			if !feed.LastErrorAt.Valid || !feed.LastErrorAt.Time.Add(backoff).Before(now) {
+				continue
+			}
+		}
+		due = append(due, feed)
+	}
+
+	// ORDER BY last_fetched_at ASC NULLS FIRST
+	slices.SortFunc(due, func(a, b database.Feed) int {
+		switch {
+		case a.LastFetchedAt.Valid != b.LastFetchedAt.Valid:
+			if a.LastFetchedAt.Valid {
+				return 1
+			}
+			return -1
+		case a.LastFetchedAt.Valid:
+			if c := a.LastFetchedAt.Time.Compare(b.LastFetchedAt.Time); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(a.FeverID, b.FeverID)
+	})
+
+	due = page(due, arg.Limit, 0)
+	for i := range due {
+		due[i].LastFetchedAt = arg.LastFetchedAt
+		s.t.feeds[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (s *Store) GetPost(ctx context.Context, id uuid.UUID) (database.Post, error) {
+	defer s.lock()()
+	post, ok := s.t.posts[id]
+	if !ok {
+		return database.Post{}, sql.ErrNoRows
+	}
+	return post, nil
+}
+
+func (s *Store) GetPostByFeverID(ctx context.Context, feverID int64) (database.Post, error) {
+	defer s.lock()()
+	for _, post := range s.t.posts {
+		if post.FeverID == feverID {
+			return post, nil
+		}
+	}
+	return database.Post{}, sql.ErrNoRows
+}
+
+func (s *Store) GetPostsForUser(ctx context.Context, arg database.GetPostsForUserParams) ([]database.GetPostsForUserRow, error) {
+	defer s.lock()()
+
+	posts := s.t.followedPosts(arg.UserID)
+	slices.SortFunc(posts, func(a, b followedPost) int { return byPublished(a.post, b.post) })
+
+	var rows []database.GetPostsForUserRow
+	for _, fp := range page(posts, arg.Limit, arg.Offset) {
+		rows = append(rows, database.GetPostsForUserRow{
+			FeedName:    fp.feed.Name,
+			UserName:    s.t.users[arg.UserID].Name,
+			ID:          fp.post.ID,
+			Title:       fp.post.Title,
+			Url:         fp.post.Url,
+			Description: fp.post.Description,
+			CreatedAt:   fp.post.CreatedAt,
+			UpdatedAt:   fp.post.UpdatedAt,
+			PublishedAt: fp.post.PublishedAt,
+			FeedID:      fp.post.FeedID,
+			Guid:        fp.post.Guid,
+			ContentHash: fp.post.ContentHash,
+			Search:      fp.post.Search,
+			FeverID:     fp.post.FeverID,
+		})
+	}
+	return rows, nil
+}
+
+func (s *Store) GetPrunablePosts(ctx context.Context, arg database.GetPrunablePostsParams) ([]database.GetPrunablePostsRow, error) {
+	defer s.lock()()
+
+	byFeed := map[uuid.UUID][]database.Post{}
+	for _, post := range s.t.posts {
+		byFeed[post.FeedID] = append(byFeed[post.FeedID], post)
+	}
+
+	var rows []database.GetPrunablePostsRow
+	for feedID, posts := range byFeed {
+		feed := s.t.feeds[feedID]
+		maxAgeDays, maxPosts := arg.DefaultMaxAgeDays, arg.DefaultMaxPosts
+		if feed.RetentionMaxAgeDays.Valid {
+			maxAgeDays = feed.RetentionMaxAgeDays.Int32
+		}
+		if feed.RetentionMaxPosts.Valid {
+			maxPosts = feed.RetentionMaxPosts.Int32
+		}
+		cutoff := arg.Now.Add(-time.Duration(maxAgeDays) * 24 * time.Hour)
+
+		// row_number() OVER (... ORDER BY posts.published_at DESC, posts.id)
+		slices.SortFunc(posts, func(a, b database.Post) int {
+			if c := b.PublishedAt.Compare(a.PublishedAt); c != 0 {
+				return c
+			}
+			return bytes.Compare(a.ID[:], b.ID[:])
+		})
+
+		for i, post := range posts {
+			expired := maxAgeDays > 0 && post.PublishedAt.Before(cutoff)
+			overLimit := maxPosts > 0 && i >= int(maxPosts)
+			if !expired && !overLimit || s.t.isStarred(post.ID) {
+				continue
+			}
+			if !expired && s.t.hasUnreadFollower(post) {
+				continue
+			}
+			rows = append(rows, database.GetPrunablePostsRow{
+				ID:       post.ID,
+				FeedID:   post.FeedID,
+				FeedName: feed.Name,
+				FeedUrl:  feed.Url,
+			})
+		}
+	}
+	slices.SortFunc(rows, func(a, b database.GetPrunablePostsRow) int {
+		return cmp.Compare(a.FeedName, b.FeedName)
+	})
+	return rows, nil
+}
+
+// isStarred reports whether any user starred the post
+func (t *tables) isStarred(postID uuid.UUID) bool {
+	for key, state := range t.postStates {
+		if key.PostID == postID && state.Starred {
+			return true
+		}
+	}
+	return false
+}
+
+// hasUnreadFollower reports whether someone following the post's feed hasn't read it
+func (t *tables) hasUnreadFollower(post database.Post) bool {
+	for _, follow := range t.feedFollows {
+		if follow.FeedID == post.FeedID && !t.isRead(follow.UserID, post.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) GetSavedFeverIDsForUser(ctx context.Context, userID uuid.UUID) ([]int64, error) {
+	defer s.lock()()
+
+	var ids []int64
+	for key, state := range s.t.postStates {
+		if key.UserID == userID && state.Starred {
+			ids = append(ids, s.t.posts[key.PostID].FeverID)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (s *Store) GetStarredPost(ctx context.Context, arg database.GetStarredPostParams) (database.Post, error) {
+	defer s.lock()()
+	state, ok := s.t.postStates[postStateKey{UserID: arg.UserID, PostID: arg.PostID}]
+	if !ok || !state.Starred {
+		return database.Post{}, sql.ErrNoRows
+	}
+	return s.t.posts[arg.PostID], nil
+}
+
+func (s *Store) GetStarredPostsForUser(ctx context.Context, arg database.GetStarredPostsForUserParams) ([]database.GetStarredPostsForUserRow, error) {
+	defer s.lock()()
+
+	var rows []database.GetStarredPostsForUserRow
+	for key, state := range s.t.postStates {
+		if key.UserID != arg.UserID || !state.Starred {
+			continue
+		}
+		post := s.t.posts[key.PostID]
+		rows = append(rows, database.GetStarredPostsForUserRow{
+			FeedName:    s.t.feeds[post.FeedID].Name,
+			ID:          post.ID,
+			Title:       post.Title,
+			Url:         post.Url,
+			Description: post.Description,
+			CreatedAt:   post.CreatedAt,
+			UpdatedAt:   post.UpdatedAt,
+			PublishedAt: post.PublishedAt,
+			FeedID:      post.FeedID,
+			Guid:        post.Guid,
+			ContentHash: post.ContentHash,
+			Search:      post.Search,
+			FeverID:     post.FeverID,
+			StarredAt:   state.StarredAt,
+		})
+	}
+	slices.SortFunc(rows, func(a, b database.GetStarredPostsForUserRow) int {
+		return cmp.Or(b.StarredAt.Time.Compare(a.StarredAt.Time), cmp.Compare(b.FeverID, a.FeverID))
+	})
+	return page(rows, arg.Limit, 0), nil
+}
+
+func (s *Store) GetTimelineForUser(ctx context.Context, arg database.GetTimelineForUserParams) ([]database.GetTimelineForUserRow, error) {
+	defer s.lock()()
+
+	var posts []followedPost
+	for _, fp := range s.t.followedPosts(arg.UserID) {
+		if arg.FeedID.Valid && fp.feed.ID != arg.FeedID.UUID {
+			continue
+		}
+		// a tag matches its own folder and every folder nested below it
+		if arg.Category.Valid && fp.follow.Category != arg.Category.String && !strings.HasPrefix(fp.follow.Category, arg.Category.String+"/") {
+			continue
+		}
+		posts = append(posts, fp)
+	}
+	slices.SortFunc(posts, func(a, b followedPost) int { return byPublished(a.post, b.post) })
+
+	var rows []database.GetTimelineForUserRow
+	for _, fp := range page(posts, arg.MaxPosts, 0) {
+		rows = append(rows, database.GetTimelineForUserRow{
+			FeedName:    fp.feed.Name,
+			FeedUrl:     fp.feed.Url,
+			ID:          fp.post.ID,
+			Title:       fp.post.Title,
+			Url:         fp.post.Url,
+			Description: fp.post.Description,
+			CreatedAt:   fp.post.CreatedAt,
+			UpdatedAt:   fp.post.UpdatedAt,
+			PublishedAt: fp.post.PublishedAt,
+			FeedID:      fp.post.FeedID,
+			Guid:        fp.post.Guid,
+			ContentHash: fp.post.ContentHash,
+			Search:      fp.post.Search,
+			FeverID:     fp.post.FeverID,
+		})
+	}
+	return rows, nil
+}
+
+func (s *Store) GetUnreadCountsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetUnreadCountsForUserRow, error) {
+	defer s.lock()()
+
+	var rows []database.GetUnreadCountsForUserRow
+	for _, follow := range s.t.feedFollows {
+		if follow.UserID != userID {
+			continue
+		}
+		row := database.GetUnreadCountsForUserRow{
+			FeedID:   follow.FeedID,
+			FeedName: s.t.feeds[follow.FeedID].Name,
+		}
+		for _, post := range s.t.posts {
+			if post.FeedID == follow.FeedID && !s.t.isRead(userID, post.ID) {
+				row.Unread++
+			}
+		}
+		rows = append(rows, row)
+	}
+	slices.SortFunc(rows, func(a, b database.GetUnreadCountsForUserRow) int {
+		return cmp.Compare(a.FeedName, b.FeedName)
+	})
+	return rows, nil
+}
+
+func (s *Store) GetUnreadFeverIDsForUser(ctx context.Context, userID uuid.UUID) ([]int64, error) {
+	defer s.lock()()
+
+	var ids []int64
+	for _, fp := range s.t.followedPosts(userID) {
+		if !s.t.isRead(userID, fp.post.ID) {
+			ids = append(ids, fp.post.FeverID)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (s *Store) GetUnreadPostsForUser(ctx context.Context, arg database.GetUnreadPostsForUserParams) ([]database.GetUnreadPostsForUserRow, error) {
+	defer s.lock()()
+
+	var posts []followedPost
+	for _, fp := range s.t.followedPosts(arg.UserID) {
+		if !s.t.isRead(arg.UserID, fp.post.ID) {
+			posts = append(posts, fp)
+		}
+	}
+	slices.SortFunc(posts, func(a, b followedPost) int { return byPublished(a.post, b.post) })
+
+	var rows []database.GetUnreadPostsForUserRow
+	for _, fp := range page(posts, arg.Limit, 0) {
+		rows = append(rows, database.GetUnreadPostsForUserRow{
+			FeedName:    fp.feed.Name,
+			UserName:    s.t.users[arg.UserID].Name,
+			ID:          fp.post.ID,
+			Title:       fp.post.Title,
+			Url:         fp.post.Url,
+			Description: fp.post.Description,
+			CreatedAt:   fp.post.CreatedAt,
+			UpdatedAt:   fp.post.UpdatedAt,
+			PublishedAt: fp.post.PublishedAt,
+			FeedID:      fp.post.FeedID,
+			Guid:        fp.post.Guid,
+			ContentHash: fp.post.ContentHash,
+			Search:      fp.post.Search,
+			FeverID:     fp.post.FeverID,
+		})
+	}
+	return rows, nil
+}
+
+func (s *Store) GetUserByAPIKey(ctx context.Context, apiKeyHash sql.NullString) (database.User, error) {
+	defer s.lock()()
+	for _, user := range s.t.users {
+		if sameString(user.ApiKeyHash, apiKeyHash) {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (s *Store) GetUserByFeverKey(ctx context.Context, feverApiKey sql.NullString) (database.User, error) {
+	defer s.lock()()
+	for _, user := range s.t.users {
+		if sameString(user.FeverApiKey, feverApiKey) {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (s *Store) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	defer s.lock()()
+	user, ok := s.t.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (s *Store) GetUserByName(ctx context.Context, name string) (database.User, error) {
+	defer s.lock()()
+	for _, user := range s.t.users {
+		if user.Name == name {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (s *Store) GetUserBySession(ctx context.Context, arg database.GetUserBySessionParams) (database.User, error) {
+	defer s.lock()()
+	session, ok := s.t.sessions[arg.TokenHash]
+	if !ok || !session.ExpiresAt.After(arg.ExpiresAt) {
+		return database.User{}, sql.ErrNoRows
+	}
+	return s.t.users[session.UserID], nil
+}
+
+func (s *Store) GetUsers(ctx context.Context) ([]database.User, error) {
+	defer s.lock()()
+	users := slices.Collect(maps.Values(s.t.users))
+	slices.SortFunc(users, byCreatedAt(func(user database.User) time.Time { return user.CreatedAt }))
+	return users, nil
+}
+
+func (s *Store) GetWebhooksForFeed(ctx context.Context, feedID uuid.UUID) ([]database.Webhook, error) {
+	defer s.lock()()
+
+	var hooks []database.Webhook
+	for _, hook := range s.t.webhooks {
+		if hook.FeedID.Valid {
+			if hook.FeedID.UUID == feedID {
+				hooks = append(hooks, hook)
+			}
+			continue
+		}
+		// webhooks without a feed only fire for feeds their owner follows
+		if _, ok := s.t.follows(hook.UserID, feedID); ok {
+			hooks = append(hooks, hook)
+		}
+	}
+	slices.SortFunc(hooks, byCreatedAt(func(hook database.Webhook) time.Time { return hook.CreatedAt }))
+	return hooks, nil
+}
+
+func (s *Store) GetWebhooksForUser(ctx context.Context, userID uuid.UUID) ([]database.GetWebhooksForUserRow, error) {
+	defer s.lock()()
+
+	var rows []database.GetWebhooksForUserRow
+	for _, hook := range s.t.webhooks {
+		if hook.UserID != userID {
+			continue
+		}
+		row := database.GetWebhooksForUserRow{
+			ID:        hook.ID,
+			CreatedAt: hook.CreatedAt,
+			UserID:    hook.UserID,
+			FeedID:    hook.FeedID,
+			Url:       hook.Url,
+			Secret:    hook.Secret,
+		}
+		if feed, ok := s.t.feeds[hook.FeedID.UUID]; hook.FeedID.Valid && ok {
+			row.FeedUrl = sql.NullString{String: feed.Url, Valid: true}
+		}
+		rows = append(rows, row)
+	}
+	slices.SortFunc(rows, byCreatedAt(func(row database.GetWebhooksForUserRow) time.Time { return row.CreatedAt }))
+	return rows, nil
+}
+
+func (s *Store) IsPostPruned(ctx context.Context, arg database.IsPostPrunedParams) (bool, error) {
+	defer s.lock()()
+	_, ok := s.t.prunedPosts[prunedPostKey(arg)]
+	return ok, nil
+}
+
+func (s *Store) MarkAllPostsRead(ctx context.Context, arg database.MarkAllPostsReadParams) (int64, error) {
+	defer s.lock()()
+
+	var marked int64
+	for _, fp := range s.t.followedPosts(arg.UserID) {
+		if arg.FeedID.Valid && fp.post.FeedID != arg.FeedID.UUID {
+			continue
+		}
+		if arg.Category.Valid && fp.follow.Category != arg.Category.String {
+			continue
+		}
+		if arg.CreatedBefore.Valid && !fp.post.CreatedAt.Before(arg.CreatedBefore.Time) {
+			continue
+		}
+
+		key := postStateKey{UserID: arg.UserID, PostID: fp.post.ID}
+		state, ok := s.t.postStates[key]
+		if ok && state.Read {
+			continue
+		}
+		state.UserID, state.PostID = key.UserID, key.PostID
+		state.Read = true
+		state.ReadAt = arg.ReadAt
+		s.t.postStates[key] = state
+		marked++
+	}
+	return marked, nil
+}
+
+func (s *Store) MarkFeedFailed(ctx context.Context, arg database.MarkFeedFailedParams) error {
+	defer s.lock()()
+
+	feed, ok := s.t.feeds[arg.ID]
+	if !ok {
+		return nil
+	}
+	feed.LastFetchedAt = arg.LastFetchedAt
+	feed.ErrorCount++
+	feed.LastError = arg.LastError
+	feed.LastErrorAt = arg.LastFetchedAt
+	s.t.feeds[feed.ID] = feed
+	return nil
+}
+
+func (s *Store) MarkFeedFetched(ctx context.Context, arg database.MarkFeedFetchedParams) error {
+	defer s.lock()()
+
+	feed, ok := s.t.feeds[arg.ID]
+	if !ok {
+		return nil
+	}
+	feed.LastFetchedAt = arg.LastFetchedAt
+	feed.UpdatedAt = arg.LastFetchedAt.Time
+	feed.Etag = arg.Etag
+	feed.LastModified = arg.LastModified
+	feed.ErrorCount = 0
+	feed.LastError = sql.NullString{}
+	feed.LastErrorAt = sql.NullTime{}
+	s.t.feeds[feed.ID] = feed
+	return nil
+}
+
+// upsertPostState returns the user's state for a post, checking the foreign
+// keys when there is none yet
+func (t *tables) upsertPostState(userID, postID uuid.UUID) (database.PostState, error) {
+	key := postStateKey{UserID: userID, PostID: postID}
+	if state, ok := t.postStates[key]; ok {
+		return state, nil
+	}
+	if _, ok := t.users[userID]; !ok {
+		return database.PostState{}, foreignKeyViolation("post_states_user_id_fkey")
+	}
+	if _, ok := t.posts[postID]; !ok {
+		return database.PostState{}, foreignKeyViolation("post_states_post_id_fkey")
+	}
+	return database.PostState{UserID: userID, PostID: postID}, nil
+}
+
+func (s *Store) MarkPostRead(ctx context.Context, arg database.MarkPostReadParams) error {
+	defer s.lock()()
+
+	state, err := s.t.upsertPostState(arg.UserID, arg.PostID)
+	if err != nil {
+		return err
+	}
+	state.Read = true
+	// the first read time is kept
+	if !state.ReadAt.Valid {
+		state.ReadAt = arg.ReadAt
+	}
+	s.t.postStates[postStateKey{UserID: arg.UserID, PostID: arg.PostID}] = state
+	return nil
+}
+
+func (s *Store) MarkPostUnread(ctx context.Context, arg database.MarkPostUnreadParams) error {
+	defer s.lock()()
+
+	key := postStateKey(arg)
+	state, ok := s.t.postStates[key]
+	if !ok {
+		return nil
+	}
+	state.Read = false
+	state.ReadAt = sql.NullTime{}
+	s.t.postStates[key] = state
+	return nil
+}
+
+// NotifyNewPost does nothing: there are no other processes to notify
+func (s *Store) NotifyNewPost(ctx context.Context, payload string) error {
+	return nil
+}
+
+func (s *Store) RecordPrunedPost(ctx context.Context, arg database.RecordPrunedPostParams) error {
+	defer s.lock()()
+
+	if _, ok := s.t.feeds[arg.FeedID]; !ok {
+		return foreignKeyViolation("pruned_posts_feed_id_fkey")
+	}
+	key := prunedPostKey{FeedID: arg.FeedID, Guid: arg.Guid}
+	if _, ok := s.t.prunedPosts[key]; !ok {
+		s.t.prunedPosts[key] = database.PrunedPost(arg)
+	}
+	return nil
+}
+
+func (s *Store) RemoveFeedFollow(ctx context.Context, arg database.RemoveFeedFollowParams) error {
+	defer s.lock()()
+
+	if follow, ok := s.t.follows(arg.UserID, arg.FeedID); ok {
+		delete(s.t.feedFollows, follow.ID)
+	}
+	return nil
+}
+
+// SearchPostsForUser matches whole words case-insensitively. Unlike
+// postgres it doesn't stem, so "feeds" won't find "feed".
+func (s *Store) SearchPostsForUser(ctx context.Context, arg database.SearchPostsForUserParams) ([]database.SearchPostsForUserRow, error) {
+	defer s.lock()()
+
+	terms := database.ParseWebSearch(arg.Query)
+
+	var rows []database.SearchPostsForUserRow
+	for _, fp := range s.t.followedPosts(arg.UserID) {
+		rank, ok := matchSearch(terms, fp.post.Title+" "+fp.post.Description)
+		if !ok {
+			continue
+		}
+		rows = append(rows, database.SearchPostsForUserRow{
+			FeedName:    fp.feed.Name,
+			ID:          fp.post.ID,
+			Title:       fp.post.Title,
+			Url:         fp.post.Url,
+			Description: fp.post.Description,
+			CreatedAt:   fp.post.CreatedAt,
+			UpdatedAt:   fp.post.UpdatedAt,
+			PublishedAt: fp.post.PublishedAt,
+			FeedID:      fp.post.FeedID,
+			Guid:        fp.post.Guid,
+			ContentHash: fp.post.ContentHash,
+			Search:      fp.post.Search,
+			FeverID:     fp.post.FeverID,
+			Rank:        rank,
+		})
+	}
+	slices.SortFunc(rows, func(a, b database.SearchPostsForUserRow) int {
+		return cmp.Or(
+			cmp.Compare(b.Rank, a.Rank),
+			b.PublishedAt.Compare(a.PublishedAt),
+			cmp.Compare(b.FeverID, a.FeverID),
+		)
+	})
+	return page(rows, arg.MaxResults, 0), nil
+}
+
+// matchSearch evaluates terms against doc, where AND binds tighter than OR,
+// and ranks a match by how often its terms occur
+func matchSearch(terms []database.SearchTerm, doc string) (float32, bool) {
+	text := " " + strings.Join(words(doc), " ") + " "
+	count := func(term database.SearchTerm) int {
+		phrase := strings.Join(words(term.Text), " ")
+		if phrase == "" {
+			return 0
+		}
+		return strings.Count(text, " "+phrase+" ")
+	}
+
+	var rank float32
+	matched, group, positive := false, true, false
+	for _, term := range terms {
+		n := count(term)
+		if term.Exclude {
+			if n > 0 {
+				return 0, false
+			}
+			continue
+		}
+		if term.Or && positive {
+			matched = matched || group
+			group = true
+		}
+		positive = true
+		group = group && n > 0
+		rank += float32(n)
+	}
+	matched = matched || (positive && group)
+
+	return rank, matched
+}
+
+// words lowercases s and splits it on anything but letters and digits
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func (s *Store) SetFeedRetention(ctx context.Context, arg database.SetFeedRetentionParams) error {
+	defer s.lock()()
+
+	feed, ok := s.t.feeds[arg.ID]
+	if !ok {
+		return nil
+	}
+	feed.RetentionMaxAgeDays = arg.RetentionMaxAgeDays
+	feed.RetentionMaxPosts = arg.RetentionMaxPosts
+	feed.UpdatedAt = arg.UpdatedAt
+	s.t.feeds[feed.ID] = feed
+	return nil
+}
+
+func (s *Store) SetPostStarred(ctx context.Context, arg database.SetPostStarredParams) error {
+	defer s.lock()()
+
+	state, err := s.t.upsertPostState(arg.UserID, arg.PostID)
+	if err != nil {
+		return err
+	}
+	state.Starred = arg.Starred
+	state.StarredAt = arg.StarredAt
+	s.t.postStates[postStateKey{UserID: arg.UserID, PostID: arg.PostID}] = state
+	return nil
+}
+
+func (s *Store) SetUserAPIKey(ctx context.Context, arg database.SetUserAPIKeyParams) error {
+	defer s.lock()()
+
+	user, ok := s.t.users[arg.ID]
+	if !ok {
+		return nil
+	}
+	for _, other := range s.t.users {
+		if other.ID != arg.ID && sameString(other.ApiKeyHash, arg.ApiKeyHash) {
+			return uniqueViolation("users_api_key_hash_key")
+		}
+	}
+	user.ApiKeyHash = arg.ApiKeyHash
+	user.UpdatedAt = arg.UpdatedAt
+	s.t.users[user.ID] = user
+	return nil
+}
+
+func (s *Store) SetUserFeverKey(ctx context.Context, arg database.SetUserFeverKeyParams) error {
+	defer s.lock()()
+
+	user, ok := s.t.users[arg.ID]
+	if !ok {
+		return nil
+	}
+	for _, other := range s.t.users {
+		if other.ID != arg.ID && sameString(other.FeverApiKey, arg.FeverApiKey) {
+			return uniqueViolation("users_fever_api_key_key")
+		}
+	}
+	user.FeverApiKey = arg.FeverApiKey
+	user.UpdatedAt = arg.UpdatedAt
+	s.t.users[user.ID] = user
+	return nil
+}
+
+func (s *Store) SetUserPassword(ctx context.Context, arg database.SetUserPasswordParams) error {
+	defer s.lock()()
+
+	user, ok := s.t.users[arg.ID]
+	if !ok {
+		return nil
+	}
+	user.PasswordHash = arg.PasswordHash
+	user.UpdatedAt = arg.UpdatedAt
+	s.t.users[user.ID] = user
+	return nil
+}
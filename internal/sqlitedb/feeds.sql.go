@@ -0,0 +1,305 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: feeds.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createFeed = `-- name: CreateFeed :one
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id, fever_id)
+VALUES (
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    (SELECT COALESCE(MAX(fever_id), 0) + 1 FROM feeds)
+)
+RETURNING id, name, url, created_at, updated_at, user_id, last_fetched_at, etag, last_modified, error_count, last_error, last_error_at, fever_id, retention_max_age_days, retention_max_posts
+`
+
+type CreateFeedParams struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string
+	Url       string
+	UserID    uuid.UUID
+}
+
+// sqlite has no sequences, and writes are serialized, so fever ids are
+// simply allocated past the highest one
+func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, createFeed,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.Name,
+		arg.Url,
+		arg.UserID,
+	)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Url,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ErrorCount,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.FeverID,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
+	)
+	return i, err
+}
+
+const getFeed = `-- name: GetFeed :one
+SELECT id, name, url, created_at, updated_at, user_id, last_fetched_at, etag, last_modified, error_count, last_error, last_error_at, fever_id, retention_max_age_days, retention_max_posts FROM feeds
+WHERE url = ?
+`
+
+func (q *Queries) GetFeed(ctx context.Context, url string) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeed, url)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Url,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ErrorCount,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.FeverID,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
+	)
+	return i, err
+}
+
+const getFeedById = `-- name: GetFeedById :one
+SELECT id, name, url, created_at, updated_at, user_id, last_fetched_at, etag, last_modified, error_count, last_error, last_error_at, fever_id, retention_max_age_days, retention_max_posts FROM feeds
+WHERE id = ?
+`
+
+func (q *Queries) GetFeedById(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedById, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Url,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ErrorCount,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.FeverID,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
+	)
+	return i, err
+}
+
+const getFeeds = `-- name: GetFeeds :many
+SELECT id, name, url, created_at, updated_at, user_id, last_fetched_at, etag, last_modified, error_count, last_error, last_error_at, fever_id, retention_max_age_days, retention_max_posts FROM feeds
+`
+
+func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Url,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.ErrorCount,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.FeverID,
+			&i.RetentionMaxAgeDays,
+			&i.RetentionMaxPosts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getNextFeedsToFetch = `-- name: GetNextFeedsToFetch :many
+UPDATE feeds
+SET last_fetched_at = ?1
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE (last_fetched_at IS NULL OR julianday(last_fetched_at) < julianday(?1))
+    AND (
+        error_count = 0
+        OR julianday(last_error_at) + (1 << MIN(error_count - 1, 10)) / 1440.0 < julianday(?1)
+    )
+    ORDER BY julianday(last_fetched_at) ASC NULLS FIRST
+    LIMIT CAST(?2 AS INT)
+)
+RETURNING id, name, url, created_at, updated_at, user_id, last_fetched_at, etag, last_modified, error_count, last_error, last_error_at, fever_id, retention_max_age_days, retention_max_posts
+`
+
+type GetNextFeedsToFetchParams struct {
+	LastFetchedAt sql.NullTime
+	Limit         int64
+}
+
+// claims a batch of stale feeds by stamping last_fetched_at; sqlite
+// serializes writers, so no row locking is needed. Failing feeds back off
+// exponentially: 1m, 2m, 4m, ... capped at ~17h.
+func (q *Queries) GetNextFeedsToFetch(ctx context.Context, arg GetNextFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getNextFeedsToFetch, arg.LastFetchedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Url,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.ErrorCount,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.FeverID,
+			&i.RetentionMaxAgeDays,
+			&i.RetentionMaxPosts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markFeedFailed = `-- name: MarkFeedFailed :exec
+UPDATE feeds
+SET last_fetched_at = ?2,
+    error_count = error_count + 1,
+    last_error = ?3,
+    last_error_at = ?2
+WHERE id = ?1
+`
+
+type MarkFeedFailedParams struct {
+	ID            uuid.UUID
+	LastFetchedAt sql.NullTime
+	LastError     sql.NullString
+}
+
+func (q *Queries) MarkFeedFailed(ctx context.Context, arg MarkFeedFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markFeedFailed, arg.ID, arg.LastFetchedAt, arg.LastError)
+	return err
+}
+
+const markFeedFetched = `-- name: MarkFeedFetched :exec
+UPDATE feeds
+SET last_fetched_at = ?2,
+    updated_at = ?2,
+    etag = ?3,
+    last_modified = ?4,
+    error_count = 0,
+    last_error = NULL,
+    last_error_at = NULL
+WHERE id = ?1
+`
+
+type MarkFeedFetchedParams struct {
+	ID            uuid.UUID
+	LastFetchedAt sql.NullTime
+	Etag          sql.NullString
+	LastModified  sql.NullString
+}
+
+func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) error {
+	_, err := q.db.ExecContext(ctx, markFeedFetched,
+		arg.ID,
+		arg.LastFetchedAt,
+		arg.Etag,
+		arg.LastModified,
+	)
+	return err
+}
+
+const setFeedRetention = `-- name: SetFeedRetention :exec
+UPDATE feeds
+SET retention_max_age_days = ?2,
+    retention_max_posts = ?3,
+    updated_at = ?4
+WHERE id = ?1
+`
+
+type SetFeedRetentionParams struct {
+	ID                  uuid.UUID
+	RetentionMaxAgeDays sql.NullInt32
+	RetentionMaxPosts   sql.NullInt32
+	UpdatedAt           time.Time
+}
+
+func (q *Queries) SetFeedRetention(ctx context.Context, arg SetFeedRetentionParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedRetention,
+		arg.ID,
+		arg.RetentionMaxAgeDays,
+		arg.RetentionMaxPosts,
+		arg.UpdatedAt,
+	)
+	return err
+}
@@ -0,0 +1,273 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: post_states.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const getStarredPost = `-- name: GetStarredPost :one
+SELECT posts.id, posts.title, posts.url, posts.description, posts.created_at, posts.updated_at, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.search, posts.fever_id FROM post_states
+INNER JOIN posts ON post_states.post_id = posts.id
+WHERE post_states.post_id = ? AND post_states.user_id = ? AND post_states.starred
+`
+
+type GetStarredPostParams struct {
+	PostID uuid.UUID
+	UserID uuid.UUID
+}
+
+// finds a post the user starred, whether or not they still follow its feed
+func (q *Queries) GetStarredPost(ctx context.Context, arg GetStarredPostParams) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getStarredPost, arg.PostID, arg.UserID)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.Search,
+		&i.FeverID,
+	)
+	return i, err
+}
+
+const getStarredPostsForUser = `-- name: GetStarredPostsForUser :many
+SELECT
+    feeds.name AS feed_name,
+    posts.id, posts.title, posts.url, posts.description, posts.created_at, posts.updated_at, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.search, posts.fever_id,
+    post_states.starred_at
+FROM post_states
+INNER JOIN posts ON post_states.post_id = posts.id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE post_states.user_id = ? AND post_states.starred
+ORDER BY julianday(post_states.starred_at) DESC
+LIMIT ?
+`
+
+type GetStarredPostsForUserParams struct {
+	UserID uuid.UUID
+	Limit  int64
+}
+
+type GetStarredPostsForUserRow struct {
+	FeedName    string
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	Search      interface{}
+	FeverID     int64
+	StarredAt   sql.NullTime
+}
+
+// starred posts stay listed even after the user unfollows their feed
+func (q *Queries) GetStarredPostsForUser(ctx context.Context, arg GetStarredPostsForUserParams) ([]GetStarredPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getStarredPostsForUser, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetStarredPostsForUserRow
+	for rows.Next() {
+		var i GetStarredPostsForUserRow
+		if err := rows.Scan(
+			&i.FeedName,
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+			&i.ContentHash,
+			&i.Search,
+			&i.FeverID,
+			&i.StarredAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnreadCountsForUser = `-- name: GetUnreadCountsForUser :many
+SELECT
+    feeds.id AS feed_id,
+    feeds.name AS feed_name,
+    COUNT(CASE WHEN post_states.read IS NOT TRUE THEN posts.id END) AS unread
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+LEFT JOIN posts ON posts.feed_id = feeds.id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = ?
+GROUP BY feeds.id, feeds.name
+ORDER BY feeds.name
+`
+
+type GetUnreadCountsForUserRow struct {
+	FeedID   uuid.UUID
+	FeedName string
+	Unread   int64
+}
+
+func (q *Queries) GetUnreadCountsForUser(ctx context.Context, userID uuid.UUID) ([]GetUnreadCountsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUnreadCountsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUnreadCountsForUserRow
+	for rows.Next() {
+		var i GetUnreadCountsForUserRow
+		if err := rows.Scan(&i.FeedID, &i.FeedName, &i.Unread); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markAllPostsRead = `-- name: MarkAllPostsRead :execrows
+INSERT INTO post_states (user_id, post_id, read, read_at)
+SELECT feed_follows.user_id, posts.id, TRUE, ?1
+FROM posts
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = ?2
+AND (posts.feed_id = ?3 OR ?3 IS NULL)
+AND (feed_follows.category = ?4 OR ?4 IS NULL)
+AND (?5 IS NULL OR julianday(posts.created_at) < julianday(?5))
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE,
+    read_at = excluded.read_at
+WHERE NOT post_states.read
+`
+
+type MarkAllPostsReadParams struct {
+	ReadAt        sql.NullTime
+	UserID        uuid.UUID
+	FeedID        uuid.NullUUID
+	Category      sql.NullString
+	CreatedBefore interface{}
+}
+
+// marks every post in the user's followed feeds read, optionally only those
+// of one feed or category, or ingested before a point in time
+func (q *Queries) MarkAllPostsRead(ctx context.Context, arg MarkAllPostsReadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markAllPostsRead,
+		arg.ReadAt,
+		arg.UserID,
+		arg.FeedID,
+		arg.Category,
+		arg.CreatedBefore,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markPostRead = `-- name: MarkPostRead :exec
+INSERT INTO post_states (user_id, post_id, read, read_at)
+VALUES (
+    ?,
+    ?,
+    TRUE,
+    ?
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE,
+    read_at = COALESCE(post_states.read_at, excluded.read_at)
+`
+
+type MarkPostReadParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt sql.NullTime
+}
+
+func (q *Queries) MarkPostRead(ctx context.Context, arg MarkPostReadParams) error {
+	_, err := q.db.ExecContext(ctx, markPostRead, arg.UserID, arg.PostID, arg.ReadAt)
+	return err
+}
+
+const markPostUnread = `-- name: MarkPostUnread :exec
+UPDATE post_states
+SET read = FALSE,
+    read_at = NULL
+WHERE user_id = ? AND post_id = ?
+`
+
+type MarkPostUnreadParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+}
+
+func (q *Queries) MarkPostUnread(ctx context.Context, arg MarkPostUnreadParams) error {
+	_, err := q.db.ExecContext(ctx, markPostUnread, arg.UserID, arg.PostID)
+	return err
+}
+
+const setPostStarred = `-- name: SetPostStarred :exec
+INSERT INTO post_states (user_id, post_id, starred, starred_at)
+VALUES (
+    ?,
+    ?,
+    ?,
+    ?
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET starred = excluded.starred,
+    starred_at = excluded.starred_at
+`
+
+type SetPostStarredParams struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	Starred   bool
+	StarredAt sql.NullTime
+}
+
+func (q *Queries) SetPostStarred(ctx context.Context, arg SetPostStarredParams) error {
+	_, err := q.db.ExecContext(ctx, setPostStarred,
+		arg.UserID,
+		arg.PostID,
+		arg.Starred,
+		arg.StarredAt,
+	)
+	return err
+}
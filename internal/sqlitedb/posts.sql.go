@@ -0,0 +1,692 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: posts.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const adoptLegacyPostGUID = `-- name: AdoptLegacyPostGUID :exec
+UPDATE OR IGNORE posts
+SET guid = ?1
+WHERE posts.feed_id = ?2
+    AND posts.guid = ?3
+    AND posts.url = ?3
+    AND posts.content_hash = ''
+`
+
+type AdoptLegacyPostGUIDParams struct {
+	Guid   string
+	FeedID uuid.UUID
+	Url    string
+}
+
+// posts stored before guids were tracked have their url as a placeholder guid
+// and no content hash. The first fetch that sees the item's real guid moves
+// the post onto it, so CreatePost updates it instead of storing a copy. OR
+// IGNORE leaves the post alone when the guid is already taken.
+func (q *Queries) AdoptLegacyPostGUID(ctx context.Context, arg AdoptLegacyPostGUIDParams) error {
+	_, err := q.db.ExecContext(ctx, adoptLegacyPostGUID, arg.Guid, arg.FeedID, arg.Url)
+	return err
+}
+
+const createPost = `-- name: CreatePost :one
+INSERT INTO posts (id, created_at, updated_at, published_at, url, feed_id, title, description, guid, content_hash, fever_id)
+VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4,
+    ?5,
+    ?6,
+    ?7,
+    ?8,
+    ?9,
+    ?10,
+    (SELECT COALESCE(MAX(fever_id), 0) + 1 FROM posts)
+)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = excluded.title,
+    url = excluded.url,
+    description = excluded.description,
+    updated_at = excluded.updated_at,
+    content_hash = excluded.content_hash
+WHERE posts.content_hash <> excluded.content_hash
+RETURNING
+    id, title, url, description, created_at, updated_at, published_at,
+    feed_id, guid, content_hash, search, fever_id,
+    (id = ?1) AS inserted
+`
+
+type CreatePostParams struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PublishedAt time.Time
+	Url         string
+	FeedID      uuid.UUID
+	Title       string
+	Description string
+	Guid        string
+	ContentHash string
+}
+
+type CreatePostRow struct {
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	Search      interface{}
+	FeverID     int64
+	Column13    interface{}
+}
+
+// inserts a new post, or updates it in place when the item was edited since
+// it was last fetched. Unchanged items return no rows. A post keeps its id
+// when updated, which is how inserted tells the two apart.
+func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (CreatePostRow, error) {
+	row := q.db.QueryRowContext(ctx, createPost,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.PublishedAt,
+		arg.Url,
+		arg.FeedID,
+		arg.Title,
+		arg.Description,
+		arg.Guid,
+		arg.ContentHash,
+	)
+	var i CreatePostRow
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.Search,
+		&i.FeverID,
+		&i.Column13,
+	)
+	return i, err
+}
+
+const deleteUnstarredPosts = `-- name: DeleteUnstarredPosts :many
+DELETE FROM posts
+WHERE id IN (/*SLICE:ids*/?)
+AND NOT EXISTS (
+    SELECT 1 FROM post_states
+    WHERE post_states.post_id = posts.id AND post_states.starred
+)
+RETURNING feed_id, guid
+`
+
+type DeleteUnstarredPostsRow struct {
+	FeedID uuid.UUID
+	Guid   string
+}
+
+// checks for stars again in case one was added since the posts were listed,
+// and returns the feed and guid of every deleted post
+func (q *Queries) DeleteUnstarredPosts(ctx context.Context, ids []uuid.UUID) ([]DeleteUnstarredPostsRow, error) {
+	query := deleteUnstarredPosts
+	var queryParams []interface{}
+	if len(ids) > 0 {
+		for _, v := range ids {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:ids*/?", strings.Repeat(",?", len(ids))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DeleteUnstarredPostsRow
+	for rows.Next() {
+		var i DeleteUnstarredPostsRow
+		if err := rows.Scan(&i.FeedID, &i.Guid); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFollowedPost = `-- name: GetFollowedPost :one
+SELECT posts.id, posts.title, posts.url, posts.description, posts.created_at, posts.updated_at, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.search, posts.fever_id, feeds.name AS feed_name FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE posts.id = ? AND feed_follows.user_id = ?
+`
+
+type GetFollowedPostParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+type GetFollowedPostRow struct {
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	Search      interface{}
+	FeverID     int64
+	FeedName    string
+}
+
+// returns no rows unless the user follows the post's feed
+func (q *Queries) GetFollowedPost(ctx context.Context, arg GetFollowedPostParams) (GetFollowedPostRow, error) {
+	row := q.db.QueryRowContext(ctx, getFollowedPost, arg.ID, arg.UserID)
+	var i GetFollowedPostRow
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.Search,
+		&i.FeverID,
+		&i.FeedName,
+	)
+	return i, err
+}
+
+const getPost = `-- name: GetPost :one
+SELECT id, title, url, description, created_at, updated_at, published_at, feed_id, guid, content_hash, search, fever_id FROM posts
+WHERE id = ?
+`
+
+func (q *Queries) GetPost(ctx context.Context, id uuid.UUID) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPost, id)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.Search,
+		&i.FeverID,
+	)
+	return i, err
+}
+
+const getPostsForUser = `-- name: GetPostsForUser :many
+SELECT
+    feeds.name AS feed_name,
+    users.name AS user_name,
+    posts.id, posts.title, posts.url, posts.description, posts.created_at, posts.updated_at, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.search, posts.fever_id
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN users ON feed_follows.user_id = users.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = ?
+ORDER BY julianday(posts.published_at) DESC
+LIMIT ? OFFSET ?
+`
+
+type GetPostsForUserParams struct {
+	UserID uuid.UUID
+	Limit  int64
+	Offset int64
+}
+
+type GetPostsForUserRow struct {
+	FeedName    string
+	UserName    string
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	Search      interface{}
+	FeverID     int64
+}
+
+func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostsForUserRow
+	for rows.Next() {
+		var i GetPostsForUserRow
+		if err := rows.Scan(
+			&i.FeedName,
+			&i.UserName,
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+			&i.ContentHash,
+			&i.Search,
+			&i.FeverID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPrunablePosts = `-- name: GetPrunablePosts :many
+SELECT
+    posts.id,
+    posts.feed_id,
+    feeds.name AS feed_name,
+    feeds.url AS feed_url
+FROM posts
+INNER JOIN feeds ON feeds.id = posts.feed_id
+WHERE NOT EXISTS (
+    SELECT 1 FROM post_states
+    WHERE post_states.post_id = posts.id AND post_states.starred
+)
+AND (
+    (
+        COALESCE(feeds.retention_max_age_days, CAST(?1 AS INT)) > 0
+        AND julianday(posts.published_at) < julianday(?2) - COALESCE(feeds.retention_max_age_days, CAST(?1 AS INT))
+    )
+    OR (
+        COALESCE(feeds.retention_max_posts, CAST(?3 AS INT)) > 0
+        AND COALESCE(feeds.retention_max_posts, CAST(?3 AS INT)) <= (
+            SELECT COUNT(*) FROM posts AS newer
+            WHERE newer.feed_id = posts.feed_id
+            AND (
+                julianday(newer.published_at) > julianday(posts.published_at)
+                OR (julianday(newer.published_at) = julianday(posts.published_at) AND newer.id < posts.id)
+            )
+        )
+        AND NOT EXISTS (
+            SELECT 1 FROM feed_follows
+            LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+            WHERE feed_follows.feed_id = posts.feed_id AND post_states.read IS NOT TRUE
+        )
+    )
+)
+ORDER BY feeds.name
+`
+
+type GetPrunablePostsParams struct {
+	DefaultMaxAgeDays int64
+	Now               interface{}
+	DefaultMaxPosts   int64
+}
+
+type GetPrunablePostsRow struct {
+	ID       uuid.UUID
+	FeedID   uuid.UUID
+	FeedName string
+	FeedUrl  string
+}
+
+// lists the posts past their feed's retention: older than the max age, or
+// beyond the newest max posts. A feed's own limits override the defaults and
+// 0 means no limit. Starred posts are always kept, and so are posts a
+// follower hasn't read yet until they pass the max age.
+// sqlc can't follow columns computed in a CTE or subquery here, so unlike
+// postgres this counts the newer posts instead of using row_number().
+func (q *Queries) GetPrunablePosts(ctx context.Context, arg GetPrunablePostsParams) ([]GetPrunablePostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPrunablePosts, arg.DefaultMaxAgeDays, arg.Now, arg.DefaultMaxPosts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPrunablePostsRow
+	for rows.Next() {
+		var i GetPrunablePostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.FeedID,
+			&i.FeedName,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTimelineForUser = `-- name: GetTimelineForUser :many
+SELECT
+    feeds.name AS feed_name,
+    feeds.url AS feed_url,
+    posts.id, posts.title, posts.url, posts.description, posts.created_at, posts.updated_at, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.search, posts.fever_id
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = ?1
+AND (feed_follows.feed_id = ?2 OR ?2 IS NULL)
+AND (
+    feed_follows.category = ?3
+    OR feed_follows.category LIKE ?3 || '/%'
+    OR ?3 IS NULL
+)
+ORDER BY julianday(posts.published_at) DESC
+LIMIT ?4
+`
+
+type GetTimelineForUserParams struct {
+	UserID   uuid.UUID
+	FeedID   uuid.NullUUID
+	Category sql.NullString
+	MaxPosts int64
+}
+
+type GetTimelineForUserRow struct {
+	FeedName    string
+	FeedUrl     string
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	Search      interface{}
+	FeverID     int64
+}
+
+// optionally narrowed to one followed feed, or to a category tag and the
+// folders nested below it
+func (q *Queries) GetTimelineForUser(ctx context.Context, arg GetTimelineForUserParams) ([]GetTimelineForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getTimelineForUser,
+		arg.UserID,
+		arg.FeedID,
+		arg.Category,
+		arg.MaxPosts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTimelineForUserRow
+	for rows.Next() {
+		var i GetTimelineForUserRow
+		if err := rows.Scan(
+			&i.FeedName,
+			&i.FeedUrl,
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+			&i.ContentHash,
+			&i.Search,
+			&i.FeverID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnreadPostsForUser = `-- name: GetUnreadPostsForUser :many
+SELECT
+    feeds.name AS feed_name,
+    users.name AS user_name,
+    posts.id, posts.title, posts.url, posts.description, posts.created_at, posts.updated_at, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.search, posts.fever_id
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN users ON feed_follows.user_id = users.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = ? AND post_states.read IS NOT TRUE
+ORDER BY julianday(posts.published_at) DESC
+LIMIT ?
+`
+
+type GetUnreadPostsForUserParams struct {
+	UserID uuid.UUID
+	Limit  int64
+}
+
+type GetUnreadPostsForUserRow struct {
+	FeedName    string
+	UserName    string
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	Search      interface{}
+	FeverID     int64
+}
+
+func (q *Queries) GetUnreadPostsForUser(ctx context.Context, arg GetUnreadPostsForUserParams) ([]GetUnreadPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUnreadPostsForUser, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUnreadPostsForUserRow
+	for rows.Next() {
+		var i GetUnreadPostsForUserRow
+		if err := rows.Scan(
+			&i.FeedName,
+			&i.UserName,
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+			&i.ContentHash,
+			&i.Search,
+			&i.FeverID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isPostPruned = `-- name: IsPostPruned :one
+SELECT EXISTS (
+    SELECT 1 FROM pruned_posts
+    WHERE feed_id = ? AND guid = ?
+)
+`
+
+type IsPostPrunedParams struct {
+	FeedID uuid.UUID
+	Guid   string
+}
+
+func (q *Queries) IsPostPruned(ctx context.Context, arg IsPostPrunedParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, isPostPruned, arg.FeedID, arg.Guid)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const recordPrunedPost = `-- name: RecordPrunedPost :exec
+INSERT INTO pruned_posts (feed_id, guid, pruned_at)
+VALUES (?, ?, ?)
+ON CONFLICT DO NOTHING
+`
+
+type RecordPrunedPostParams struct {
+	FeedID   uuid.UUID
+	Guid     string
+	PrunedAt time.Time
+}
+
+func (q *Queries) RecordPrunedPost(ctx context.Context, arg RecordPrunedPostParams) error {
+	_, err := q.db.ExecContext(ctx, recordPrunedPost, arg.FeedID, arg.Guid, arg.PrunedAt)
+	return err
+}
+
+const searchPostsForUser = `-- name: SearchPostsForUser :many
+SELECT
+    feeds.name AS feed_name,
+    posts.id, posts.title, posts.url, posts.description, posts.created_at, posts.updated_at, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.search, posts.fever_id,
+    CAST(-bm25(posts_fts) AS REAL) AS "rank"
+FROM posts_fts
+INNER JOIN posts ON posts.fever_id = posts_fts.rowid
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+WHERE posts_fts.search MATCH ?1
+AND feed_follows.user_id = ?2
+ORDER BY "rank" DESC, julianday(posts.published_at) DESC
+LIMIT ?3
+`
+
+type SearchPostsForUserParams struct {
+	Query      string
+	UserID     uuid.UUID
+	MaxResults int64
+}
+
+type SearchPostsForUserRow struct {
+	FeedName    string
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	Search      interface{}
+	FeverID     int64
+	Rank        float64
+}
+
+// query uses FTS5 syntax; bm25 scores better matches lower, so it is negated
+// to rank like postgres' ts_rank
+func (q *Queries) SearchPostsForUser(ctx context.Context, arg SearchPostsForUserParams) ([]SearchPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPostsForUser, arg.Query, arg.UserID, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchPostsForUserRow
+	for rows.Next() {
+		var i SearchPostsForUserRow
+		if err := rows.Scan(
+			&i.FeedName,
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+			&i.ContentHash,
+			&i.Search,
+			&i.FeverID,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,496 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+// store adapts the sqlite queries to database.Store. sqlc generates the same
+// structs for both engines wherever it can, so most methods only convert
+// between the two packages' types.
+type store struct {
+	q  *Queries
+	db *sql.DB
+}
+
+// NewStore returns a Store backed by a SQLite database
+func NewStore(db *sql.DB) database.Store {
+	return &store{
+		q:  New(db),
+		db: db,
+	}
+}
+
+func (s *store) InTx(ctx context.Context, fn func(q database.Querier) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	// a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	if err := fn(&store{q: s.q.WithTx(tx), db: s.db}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// convertRows converts every row of a :many query to its database type
+func convertRows[T, U any](rows []T, err error, convert func(T) U) ([]U, error) {
+	if err != nil {
+		return nil, err
+	}
+	converted := make([]U, 0, len(rows))
+	for _, row := range rows {
+		converted = append(converted, convert(row))
+	}
+	return converted, nil
+}
+
+func (s *store) AdoptLegacyPostGUID(ctx context.Context, arg database.AdoptLegacyPostGUIDParams) error {
+	return s.q.AdoptLegacyPostGUID(ctx, AdoptLegacyPostGUIDParams(arg))
+}
+
+func (s *store) CountPostsForUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return s.q.CountPostsForUser(ctx, userID)
+}
+
+func (s *store) CreateFeed(ctx context.Context, arg database.CreateFeedParams) (database.Feed, error) {
+	feed, err := s.q.CreateFeed(ctx, CreateFeedParams(arg))
+	return database.Feed(feed), err
+}
+
+func (s *store) CreateFeedFollow(ctx context.Context, arg database.CreateFeedFollowParams) (database.CreateFeedFollowRow, error) {
+	follow, err := s.q.CreateFeedFollow(ctx, CreateFeedFollowParams(arg))
+	if err != nil {
+		return database.CreateFeedFollowRow{}, err
+	}
+	row, err := s.q.GetFeedFollowNames(ctx, follow.ID)
+	return database.CreateFeedFollowRow(row), err
+}
+
+func (s *store) CreatePost(ctx context.Context, arg database.CreatePostParams) (database.CreatePostRow, error) {
+	row, err := s.q.CreatePost(ctx, CreatePostParams(arg))
+	if err != nil {
+		return database.CreatePostRow{}, err
+	}
+	// sqlc drops the alias of a computed RETURNING column, so inserted comes
+	// back untyped
+	inserted, _ := row.Column13.(int64)
+	return database.CreatePostRow{
+		ID:          row.ID,
+		Title:       row.Title,
+		Url:         row.Url,
+		Description: row.Description,
+		CreatedAt:   row.CreatedAt,
+		UpdatedAt:   row.UpdatedAt,
+		PublishedAt: row.PublishedAt,
+		FeedID:      row.FeedID,
+		Guid:        row.Guid,
+		ContentHash: row.ContentHash,
+		Search:      row.Search,
+		FeverID:     row.FeverID,
+		Inserted:    inserted == 1,
+	}, nil
+}
+
+func (s *store) CreateSession(ctx context.Context, arg database.CreateSessionParams) error {
+	return s.q.CreateSession(ctx, CreateSessionParams(arg))
+}
+
+func (s *store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	user, err := s.q.CreateUser(ctx, CreateUserParams(arg))
+	return database.User(user), err
+}
+
+func (s *store) CreateWebhook(ctx context.Context, arg database.CreateWebhookParams) (database.Webhook, error) {
+	hook, err := s.q.CreateWebhook(ctx, CreateWebhookParams(arg))
+	return database.Webhook(hook), err
+}
+
+func (s *store) CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) error {
+	return s.q.CreateWebhookDelivery(ctx, CreateWebhookDeliveryParams(arg))
+}
+
+func (s *store) DeleteSession(ctx context.Context, tokenHash string) error {
+	return s.q.DeleteSession(ctx, tokenHash)
+}
+
+func (s *store) DeleteSessionsForUser(ctx context.Context, arg database.DeleteSessionsForUserParams) (int64, error) {
+	return s.q.DeleteSessionsForUser(ctx, DeleteSessionsForUserParams(arg))
+}
+
+// sqliteMaxDeleteBatch keeps DeleteUnstarredPosts under SQLite's limit on
+// bound parameters, which older builds set as low as 999
+const sqliteMaxDeleteBatch = 500
+
+func (s *store) DeleteUnstarredPosts(ctx context.Context, ids []uuid.UUID) ([]database.DeleteUnstarredPostsRow, error) {
+	var deleted []database.DeleteUnstarredPostsRow
+	for start := 0; start < len(ids); start += sqliteMaxDeleteBatch {
+		batch, err := s.q.DeleteUnstarredPosts(ctx, ids[start:min(start+sqliteMaxDeleteBatch, len(ids))])
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range batch {
+			deleted = append(deleted, database.DeleteUnstarredPostsRow(row))
+		}
+	}
+	return deleted, nil
+}
+
+func (s *store) DeleteUsers(ctx context.Context) error {
+	return s.q.DeleteUsers(ctx)
+}
+
+func (s *store) DeleteWebhook(ctx context.Context, arg database.DeleteWebhookParams) (int64, error) {
+	return s.q.DeleteWebhook(ctx, DeleteWebhookParams(arg))
+}
+
+func (s *store) GetFeed(ctx context.Context, url string) (database.Feed, error) {
+	feed, err := s.q.GetFeed(ctx, url)
+	return database.Feed(feed), err
+}
+
+func (s *store) GetFeedByFeverID(ctx context.Context, feverID int64) (database.Feed, error) {
+	feed, err := s.q.GetFeedByFeverID(ctx, feverID)
+	return database.Feed(feed), err
+}
+
+func (s *store) GetFeedById(ctx context.Context, id uuid.UUID) (database.Feed, error) {
+	feed, err := s.q.GetFeedById(ctx, id)
+	return database.Feed(feed), err
+}
+
+func (s *store) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetFeedFollowsForUserRow, error) {
+	rows, err := s.q.GetFeedFollowsForUser(ctx, userID)
+	return convertRows(rows, err, func(row GetFeedFollowsForUserRow) database.GetFeedFollowsForUserRow {
+		return database.GetFeedFollowsForUserRow(row)
+	})
+}
+
+func (s *store) GetFeeds(ctx context.Context) ([]database.Feed, error) {
+	feeds, err := s.q.GetFeeds(ctx)
+	return convertRows(feeds, err, func(feed Feed) database.Feed {
+		return database.Feed(feed)
+	})
+}
+
+func (s *store) GetFeverFeedsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetFeverFeedsForUserRow, error) {
+	rows, err := s.q.GetFeverFeedsForUser(ctx, userID)
+	return convertRows(rows, err, func(row GetFeverFeedsForUserRow) database.GetFeverFeedsForUserRow {
+		return database.GetFeverFeedsForUserRow(row)
+	})
+}
+
+func (s *store) GetFeverItemsForUser(ctx context.Context, arg database.GetFeverItemsForUserParams) ([]database.GetFeverItemsForUserRow, error) {
+	params := GetFeverItemsForUserParams{
+		UserID:   arg.UserID,
+		SinceID:  arg.SinceID,
+		MaxID:    arg.MaxID,
+		MaxItems: int64(arg.MaxItems),
+	}
+	// sqlite takes the id filter as a JSON array
+	if len(arg.WithIds) > 0 {
+		ids, err := json.Marshal(arg.WithIds)
+		if err != nil {
+			return nil, err
+		}
+		params.WithIds = string(ids)
+	}
+
+	rows, err := s.q.GetFeverItemsForUser(ctx, params)
+	return convertRows(rows, err, func(row GetFeverItemsForUserRow) database.GetFeverItemsForUserRow {
+		return database.GetFeverItemsForUserRow(row)
+	})
+}
+
+func (s *store) GetFollowedPost(ctx context.Context, arg database.GetFollowedPostParams) (database.GetFollowedPostRow, error) {
+	row, err := s.q.GetFollowedPost(ctx, GetFollowedPostParams(arg))
+	return database.GetFollowedPostRow(row), err
+}
+
+func (s *store) GetLastWebhookDelivery(ctx context.Context, webhookID uuid.UUID) (database.WebhookDelivery, error) {
+	delivery, err := s.q.GetLastWebhookDelivery(ctx, webhookID)
+	return database.WebhookDelivery(delivery), err
+}
+
+func (s *store) GetNextFeedsToFetch(ctx context.Context, arg database.GetNextFeedsToFetchParams) ([]database.Feed, error) {
+	feeds, err := s.q.GetNextFeedsToFetch(ctx, GetNextFeedsToFetchParams{
+		LastFetchedAt: arg.LastFetchedAt,
+		Limit:         int64(arg.Limit),
+	})
+	return convertRows(feeds, err, func(feed Feed) database.Feed {
+		return database.Feed(feed)
+	})
+}
+
+func (s *store) GetPost(ctx context.Context, id uuid.UUID) (database.Post, error) {
+	post, err := s.q.GetPost(ctx, id)
+	return database.Post(post), err
+}
+
+func (s *store) GetPostByFeverID(ctx context.Context, feverID int64) (database.Post, error) {
+	post, err := s.q.GetPostByFeverID(ctx, feverID)
+	return database.Post(post), err
+}
+
+func (s *store) GetPostsForUser(ctx context.Context, arg database.GetPostsForUserParams) ([]database.GetPostsForUserRow, error) {
+	rows, err := s.q.GetPostsForUser(ctx, GetPostsForUserParams{
+		UserID: arg.UserID,
+		Limit:  int64(arg.Limit),
+		Offset: int64(arg.Offset),
+	})
+	return convertRows(rows, err, func(row GetPostsForUserRow) database.GetPostsForUserRow {
+		return database.GetPostsForUserRow(row)
+	})
+}
+
+func (s *store) GetPrunablePosts(ctx context.Context, arg database.GetPrunablePostsParams) ([]database.GetPrunablePostsRow, error) {
+	rows, err := s.q.GetPrunablePosts(ctx, GetPrunablePostsParams{
+		DefaultMaxAgeDays: int64(arg.DefaultMaxAgeDays),
+		Now:               arg.Now,
+		DefaultMaxPosts:   int64(arg.DefaultMaxPosts),
+	})
+	return convertRows(rows, err, func(row GetPrunablePostsRow) database.GetPrunablePostsRow {
+		return database.GetPrunablePostsRow(row)
+	})
+}
+
+func (s *store) GetSavedFeverIDsForUser(ctx context.Context, userID uuid.UUID) ([]int64, error) {
+	return s.q.GetSavedFeverIDsForUser(ctx, userID)
+}
+
+func (s *store) GetStarredPost(ctx context.Context, arg database.GetStarredPostParams) (database.Post, error) {
+	post, err := s.q.GetStarredPost(ctx, GetStarredPostParams(arg))
+	return database.Post(post), err
+}
+
+func (s *store) GetStarredPostsForUser(ctx context.Context, arg database.GetStarredPostsForUserParams) ([]database.GetStarredPostsForUserRow, error) {
+	rows, err := s.q.GetStarredPostsForUser(ctx, GetStarredPostsForUserParams{
+		UserID: arg.UserID,
+		Limit:  int64(arg.Limit),
+	})
+	return convertRows(rows, err, func(row GetStarredPostsForUserRow) database.GetStarredPostsForUserRow {
+		return database.GetStarredPostsForUserRow(row)
+	})
+}
+
+func (s *store) GetTimelineForUser(ctx context.Context, arg database.GetTimelineForUserParams) ([]database.GetTimelineForUserRow, error) {
+	rows, err := s.q.GetTimelineForUser(ctx, GetTimelineForUserParams{
+		UserID:   arg.UserID,
+		FeedID:   arg.FeedID,
+		Category: arg.Category,
+		MaxPosts: int64(arg.MaxPosts),
+	})
+	return convertRows(rows, err, func(row GetTimelineForUserRow) database.GetTimelineForUserRow {
+		return database.GetTimelineForUserRow(row)
+	})
+}
+
+func (s *store) GetUnreadCountsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetUnreadCountsForUserRow, error) {
+	rows, err := s.q.GetUnreadCountsForUser(ctx, userID)
+	return convertRows(rows, err, func(row GetUnreadCountsForUserRow) database.GetUnreadCountsForUserRow {
+		return database.GetUnreadCountsForUserRow(row)
+	})
+}
+
+func (s *store) GetUnreadFeverIDsForUser(ctx context.Context, userID uuid.UUID) ([]int64, error) {
+	return s.q.GetUnreadFeverIDsForUser(ctx, userID)
+}
+
+func (s *store) GetUnreadPostsForUser(ctx context.Context, arg database.GetUnreadPostsForUserParams) ([]database.GetUnreadPostsForUserRow, error) {
+	rows, err := s.q.GetUnreadPostsForUser(ctx, GetUnreadPostsForUserParams{
+		UserID: arg.UserID,
+		Limit:  int64(arg.Limit),
+	})
+	return convertRows(rows, err, func(row GetUnreadPostsForUserRow) database.GetUnreadPostsForUserRow {
+		return database.GetUnreadPostsForUserRow(row)
+	})
+}
+
+func (s *store) GetUserByAPIKey(ctx context.Context, apiKeyHash sql.NullString) (database.User, error) {
+	user, err := s.q.GetUserByAPIKey(ctx, apiKeyHash)
+	return database.User(user), err
+}
+
+func (s *store) GetUserByFeverKey(ctx context.Context, feverApiKey sql.NullString) (database.User, error) {
+	user, err := s.q.GetUserByFeverKey(ctx, feverApiKey)
+	return database.User(user), err
+}
+
+func (s *store) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	user, err := s.q.GetUserById(ctx, id)
+	return database.User(user), err
+}
+
+func (s *store) GetUserByName(ctx context.Context, name string) (database.User, error) {
+	user, err := s.q.GetUserByName(ctx, name)
+	return database.User(user), err
+}
+
+func (s *store) GetUserBySession(ctx context.Context, arg database.GetUserBySessionParams) (database.User, error) {
+	user, err := s.q.GetUserBySession(ctx, GetUserBySessionParams{
+		TokenHash: arg.TokenHash,
+		ExpiresAt: arg.ExpiresAt,
+	})
+	return database.User(user), err
+}
+
+func (s *store) GetUsers(ctx context.Context) ([]database.User, error) {
+	users, err := s.q.GetUsers(ctx)
+	return convertRows(users, err, func(user User) database.User {
+		return database.User(user)
+	})
+}
+
+func (s *store) GetWebhooksForFeed(ctx context.Context, feedID uuid.UUID) ([]database.Webhook, error) {
+	hooks, err := s.q.GetWebhooksForFeed(ctx, uuid.NullUUID{UUID: feedID, Valid: true})
+	return convertRows(hooks, err, func(hook Webhook) database.Webhook {
+		return database.Webhook(hook)
+	})
+}
+
+func (s *store) GetWebhooksForUser(ctx context.Context, userID uuid.UUID) ([]database.GetWebhooksForUserRow, error) {
+	rows, err := s.q.GetWebhooksForUser(ctx, userID)
+	return convertRows(rows, err, func(row GetWebhooksForUserRow) database.GetWebhooksForUserRow {
+		return database.GetWebhooksForUserRow(row)
+	})
+}
+
+func (s *store) IsPostPruned(ctx context.Context, arg database.IsPostPrunedParams) (bool, error) {
+	pruned, err := s.q.IsPostPruned(ctx, IsPostPrunedParams(arg))
+	return pruned != 0, err
+}
+
+func (s *store) MarkAllPostsRead(ctx context.Context, arg database.MarkAllPostsReadParams) (int64, error) {
+	params := MarkAllPostsReadParams{
+		ReadAt:   arg.ReadAt,
+		UserID:   arg.UserID,
+		FeedID:   arg.FeedID,
+		Category: arg.Category,
+	}
+	if arg.CreatedBefore.Valid {
+		params.CreatedBefore = arg.CreatedBefore.Time
+	}
+	return s.q.MarkAllPostsRead(ctx, params)
+}
+
+func (s *store) MarkFeedFailed(ctx context.Context, arg database.MarkFeedFailedParams) error {
+	return s.q.MarkFeedFailed(ctx, MarkFeedFailedParams(arg))
+}
+
+func (s *store) MarkFeedFetched(ctx context.Context, arg database.MarkFeedFetchedParams) error {
+	return s.q.MarkFeedFetched(ctx, MarkFeedFetchedParams(arg))
+}
+
+func (s *store) MarkPostRead(ctx context.Context, arg database.MarkPostReadParams) error {
+	return s.q.MarkPostRead(ctx, MarkPostReadParams(arg))
+}
+
+func (s *store) MarkPostUnread(ctx context.Context, arg database.MarkPostUnreadParams) error {
+	return s.q.MarkPostUnread(ctx, MarkPostUnreadParams(arg))
+}
+
+// NotifyNewPost is a no-op: SQLite has no NOTIFY, so only the process that
+// ingested a post can stream it
+func (s *store) NotifyNewPost(ctx context.Context, payload string) error {
+	return nil
+}
+
+func (s *store) RecordPrunedPost(ctx context.Context, arg database.RecordPrunedPostParams) error {
+	return s.q.RecordPrunedPost(ctx, RecordPrunedPostParams(arg))
+}
+
+func (s *store) RemoveFeedFollow(ctx context.Context, arg database.RemoveFeedFollowParams) error {
+	return s.q.RemoveFeedFollow(ctx, RemoveFeedFollowParams(arg))
+}
+
+func (s *store) SearchPostsForUser(ctx context.Context, arg database.SearchPostsForUserParams) ([]database.SearchPostsForUserRow, error) {
+	query := ftsQuery(arg.Query)
+	// FTS5 can't match on exclusions alone
+	if query == "" {
+		return nil, nil
+	}
+
+	rows, err := s.q.SearchPostsForUser(ctx, SearchPostsForUserParams{
+		Query:      query,
+		UserID:     arg.UserID,
+		MaxResults: int64(arg.MaxResults),
+	})
+	return convertRows(rows, err, func(row SearchPostsForUserRow) database.SearchPostsForUserRow {
+		return database.SearchPostsForUserRow{
+			FeedName:    row.FeedName,
+			ID:          row.ID,
+			Title:       row.Title,
+			Url:         row.Url,
+			Description: row.Description,
+			CreatedAt:   row.CreatedAt,
+			UpdatedAt:   row.UpdatedAt,
+			PublishedAt: row.PublishedAt,
+			FeedID:      row.FeedID,
+			Guid:        row.Guid,
+			ContentHash: row.ContentHash,
+			Search:      row.Search,
+			FeverID:     row.FeverID,
+			Rank:        float32(row.Rank),
+		}
+	})
+}
+
+func (s *store) SetFeedRetention(ctx context.Context, arg database.SetFeedRetentionParams) error {
+	return s.q.SetFeedRetention(ctx, SetFeedRetentionParams(arg))
+}
+
+func (s *store) SetPostStarred(ctx context.Context, arg database.SetPostStarredParams) error {
+	return s.q.SetPostStarred(ctx, SetPostStarredParams(arg))
+}
+
+func (s *store) SetUserAPIKey(ctx context.Context, arg database.SetUserAPIKeyParams) error {
+	return s.q.SetUserAPIKey(ctx, SetUserAPIKeyParams(arg))
+}
+
+func (s *store) SetUserFeverKey(ctx context.Context, arg database.SetUserFeverKeyParams) error {
+	return s.q.SetUserFeverKey(ctx, SetUserFeverKeyParams(arg))
+}
+
+func (s *store) SetUserPassword(ctx context.Context, arg database.SetUserPasswordParams) error {
+	return s.q.SetUserPassword(ctx, SetUserPasswordParams(arg))
+}
+
+// ftsQuery translates the web search syntax that postgres' search accepts
+// into an FTS5 query. Every term is quoted so punctuation in it can't be read
+// as FTS5 syntax. It returns "" when nothing is left to match.
+func ftsQuery(search string) string {
+	var terms, excluded []string
+	for _, term := range database.ParseWebSearch(search) {
+		quoted := `"` + strings.ReplaceAll(term.Text, `"`, `""`) + `"`
+		if term.Exclude {
+			excluded = append(excluded, quoted)
+			continue
+		}
+		if len(terms) > 0 {
+			if term.Or {
+				terms = append(terms, "OR")
+			} else {
+				terms = append(terms, "AND")
+			}
+		}
+		terms = append(terms, quoted)
+	}
+
+	if len(terms) == 0 {
+		return ""
+	}
+	query := strings.Join(terms, " ")
+	for _, term := range excluded {
+		query = "(" + query + ") NOT " + term
+	}
+	return query
+}
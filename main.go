@@ -3,19 +3,23 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/xml"
+	"errors"
 	"fmt"
-	"html"
 	"internal/config"
-	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jsleep/blog_aggregator/internal/database"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 type command struct {
@@ -30,7 +34,23 @@ type state struct {
 	Config *config.Config
 
 	// db is the database connection
-	db *database.Queries
+	db database.Store
+
+	// conn is the connection pool db runs on, used for migrations
+	conn *sql.DB
+
+	// dialect is the SQL flavour of conn, which picks the migrations to run
+	dialect goose.Dialect
+
+	// hub delivers newly ingested posts to SSE streams
+	hub *postHub
+
+	// aggregating is set while serve runs agg in its own process, whose
+	// posts reach hub directly instead of through Postgres NOTIFY
+	aggregating bool
+
+	// webhooks delivers newly ingested posts to user registered URLs
+	webhooks *webhookSender
 }
 
 type commands map[string]func(*state, command) error
@@ -65,8 +85,19 @@ func loginHandler(s *state, cmd command) error {
 		return err
 	}
 
+	// users without a password can still log in by name
+	if user.PasswordHash.Valid {
+		password, err := readPassword("Password: ")
+		if err != nil {
+			return err
+		}
+		if err := checkPassword(user, password); err != nil {
+			return err
+		}
+	}
+
 	// Set the user in the configuration
-	err = s.Config.SetUser(user.Name)
+	err = startSession(s, user)
 	if err != nil {
 		return err
 	}
@@ -125,12 +156,29 @@ func registerHandler(s *state, cmd command) error {
 
 	name := cmd.Args[0]
 
+	password, err := promptNewPassword()
+	if err != nil {
+		return err
+	}
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// only the hash is stored, so this is the one chance to show the key
+	apiKey, apiKeyHash, err := generateToken()
+	if err != nil {
+		return err
+	}
+
 	// Register the user in the database
 	user, err := s.db.CreateUser(context.Background(), database.CreateUserParams{
-		ID:        uuid.New(),
-		Name:      name,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:           uuid.New(),
+		Name:         name,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		ApiKeyHash:   nullString(apiKeyHash),
+		PasswordHash: nullString(passwordHash),
 	})
 
 	if err != nil {
@@ -138,14 +186,13 @@ func registerHandler(s *state, cmd command) error {
 	}
 
 	fmt.Printf("User %s registered successfully\n", user.Name)
+	fmt.Printf("API key: %s\n", apiKey)
 
-	err = s.Config.SetUser(user.Name)
+	err = startSession(s, user)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("User data  %s\n", user)
-
 	return nil
 }
 
@@ -161,34 +208,46 @@ func addFeedHandler(s *state, cmd command, user database.User) error {
 	}
 
 	name := cmd.Args[0]
-	url := cmd.Args[1]
-
-	// add feed ti database
-	feed, err := s.db.CreateFeed(context.Background(), database.CreateFeedParams{
-		ID:        uuid.New(),
-		Name:      name,
-		Url:       url,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		UserID:    user.ID,
-	})
 
+	// users often paste a blog's homepage, so look for the feed it advertises
+	url, err := resolveFeedURL(context.Background(), cmd.Args[1])
 	if err != nil {
 		return err
 	}
+	if url != cmd.Args[1] {
+		fmt.Printf("Found feed %s\n", url)
+	}
+
+	// add the feed and follow it together, so a failed follow leaves no orphan feed
+	var feed database.Feed
+	err = s.db.InTx(context.Background(), func(q database.Querier) error {
+		// add feed ti database
+		feed, err = q.CreateFeed(context.Background(), database.CreateFeedParams{
+			ID:        uuid.New(),
+			Name:      name,
+			Url:       url,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			UserID:    user.ID,
+		})
+		if err != nil {
+			return err
+		}
 
-	// current user should follow feed they just added
-	_, err = s.db.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
-		ID:        uuid.New(),
-		UserID:    user.ID,
-		FeedID:    feed.ID,
-		CreatedAt: time.Now(),
+		// current user should follow feed they just added
+		_, err = q.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			FeedID:    feed.ID,
+			CreatedAt: time.Now(),
+		})
+		return err
 	})
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Feed %s added successfully\n", feed)
+	fmt.Printf("Feed %s added successfully\n", feed.Name)
 
 	return nil
 }
@@ -273,10 +332,19 @@ func followingHandler(s *state, cmd command, user database.User) error {
 		return err
 	}
 
+	counts, err := s.db.GetUnreadCountsForUser(context.Background(), user.ID)
+	if err != nil {
+		return err
+	}
+	unread := make(map[uuid.UUID]int64, len(counts))
+	for _, count := range counts {
+		unread[count.FeedID] = count.Unread
+	}
+
 	fmt.Printf("User %s follows:\n", user.Name)
 
 	for _, follow := range follows {
-		fmt.Printf("* %s\n", follow.FeedName)
+		fmt.Printf("* %s (%d unread)\n", follow.FeedName, unread[follow.FeedID])
 	}
 	return nil
 }
@@ -303,112 +371,177 @@ func listFeedsHandler(s *state, cmd command) error {
 			return err
 		}
 		fmt.Printf("%s \n", user.Name)
+
+		if feed.ErrorCount > 0 {
+			fmt.Printf("  failing (%d in a row): %s\n", feed.ErrorCount, feed.LastError.String)
+		}
 	}
 
 	return nil
 }
 
-func scrapeFeeds(s *state) error {
-	next_feed, err := s.db.GetNextFeedToFetch(context.Background())
-	if err != nil {
-		panic(err)
+// scrapeFeeds claims up to workers feeds not fetched since staleBefore and
+// fetches them in parallel, returning how many feeds were claimed
+func scrapeFeeds(ctx context.Context, s *state, workers int, staleBefore time.Time) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
 	}
 
-	s.db.MarkFeedFetched(context.Background(), database.MarkFeedFetchedParams{
-		ID:            next_feed.ID,
-		LastFetchedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	feeds, err := s.db.GetNextFeedsToFetch(context.Background(), database.GetNextFeedsToFetchParams{
+		LastFetchedAt: sql.NullTime{Time: staleBefore, Valid: true},
+		Limit:         int32(workers),
 	})
-
-	fmt.Printf("Fetched feed %s at %s\n", next_feed.Name, time.Now().Format(time.RFC3339))
-
-	feed, err := fetchFeed(context.Background(), next_feed.Url)
 	if err != nil {
-		panic(err)
+		return 0, fmt.Errorf("could not claim feeds: %w", err)
 	}
 
-	// Print entire feed struct
-	for _, item := range feed.Channel.Item {
-		fmt.Printf("* Item: %s", item.Title)
-		fmt.Printf(", Time: %s\n", item.PubDate)
-		parseTime, err := parseTime(item.PubDate)
-		if err != nil {
-			fmt.Printf("Error parsing time: %v\n", err)
-			continue
-		}
+	var wg sync.WaitGroup
+	for _, feed := range feeds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// a failing feed is recorded and backed off, it must not stop the others
+			if err := scrapeFeed(ctx, s, feed); err != nil {
+				fmt.Printf("Error scraping feed %s: %v\n", feed.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return len(feeds), nil
+}
 
-		post, err := s.db.CreatePost(context.Background(), database.CreatePostParams{
-			ID:          uuid.New(),
-			FeedID:      next_feed.ID,
-			Title:       item.Title,
-			Url:         item.Link,
-			CreatedAt:   time.Now(),
-			UpdatedAt:   time.Now(),
-			Description: item.Description,
-			PublishedAt: parseTime,
-		})
+// scrapeFeed fetches a single feed and stores its posts. Only the fetch
+// and webhook retries honor ctx; database writes run to completion so
+// shutdown never leaves a feed half written.
+func scrapeFeed(ctx context.Context, s *state, next_feed database.Feed) error {
+	cache := feedCacheHeaders{
+		ETag:         next_feed.Etag.String,
+		LastModified: next_feed.LastModified.String,
+	}
+	feed, cache, err := fetchFeed(ctx, next_feed.Url, cache)
+	notModified := errors.Is(err, errFeedNotModified)
 
-		if err != nil {
-			fmt.Printf("Error creating post: %v\n", err)
-			continue
-		} else {
-			fmt.Printf("Post created: %s %s\n", post.Title, post.Url)
-		}
+	// an interrupted fetch is not the publisher's fault, so don't back off
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
 
-	return nil
-}
+	if err != nil && !notModified {
+		return markFeedFailed(s, next_feed, err)
+	}
 
-type RSSFeed struct {
-	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Item        []RSSItem `xml:"item"`
-	} `xml:"channel"`
-}
+	fmt.Printf("Fetched feed %s at %s\n", next_feed.Name, time.Now().Format(time.RFC3339))
 
-type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
-}
+	// the posts and the fetch are recorded together: if any write fails the
+	// whole batch is rolled back and the feed backs off like a failed fetch
+	var stored []database.CreatePostRow
+	err = s.db.InTx(context.Background(), func(q database.Querier) error {
+		// nothing changed since the last fetch
+		if !notModified {
+			cutoff := retentionCutoff(s, next_feed, time.Now())
+			for _, item := range feed.Channel.Item {
+				fmt.Printf("* Item: %s", item.Title)
+				fmt.Printf(", Time: %s\n", item.PubDate)
+				parseTime, err := parseTime(item.PubDate)
+				if err != nil {
+					fmt.Printf("Error parsing time: %v\n", err)
+					continue
+				}
+				if parseTime.Before(cutoff) {
+					fmt.Println("Skipping item past the feed's retention")
+					continue
+				}
+
+				guid := itemGUID(item)
+				pruned, err := q.IsPostPruned(context.Background(), database.IsPostPrunedParams{
+					FeedID: next_feed.ID,
+					Guid:   guid,
+				})
+				if err != nil {
+					return fmt.Errorf("could not store post %s: %w", item.Link, err)
+				}
+				if pruned {
+					continue
+				}
+
+				// posts from before guids were tracked are keyed by their url
+				if guid != item.Link {
+					err := q.AdoptLegacyPostGUID(context.Background(), database.AdoptLegacyPostGUIDParams{
+						Guid:   guid,
+						FeedID: next_feed.ID,
+						Url:    item.Link,
+					})
+					if err != nil {
+						return fmt.Errorf("could not store post %s: %w", item.Link, err)
+					}
+				}
+
+				post, err := q.CreatePost(context.Background(), database.CreatePostParams{
+					ID:          uuid.New(),
+					FeedID:      next_feed.ID,
+					Title:       item.Title,
+					Url:         item.Link,
+					CreatedAt:   time.Now(),
+					UpdatedAt:   time.Now(),
+					Description: item.Description,
+					PublishedAt: parseTime,
+					Guid:        guid,
+					ContentHash: itemContentHash(item),
+				})
+
+				// no rows means we already have this exact version of the item
+				if errors.Is(err, sql.ErrNoRows) {
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("could not store post %s: %w", item.Link, err)
+				}
+				stored = append(stored, post)
+			}
+		}
 
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
-	r, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	client := &http.Client{}
-	r.Header.Set("User-Agent", "gator")
-	resp, err := client.Do(r)
+		return q.MarkFeedFetched(context.Background(), database.MarkFeedFetchedParams{
+			ID:            next_feed.ID,
+			LastFetchedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			Etag:          nullString(cache.ETag),
+			LastModified:  nullString(cache.LastModified),
+		})
+	})
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch feed: %s", resp.Status)
+		return markFeedFailed(s, next_feed, err)
 	}
 
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if notModified {
+		fmt.Printf("Feed %s not modified\n", next_feed.Name)
+		return nil
 	}
-	var feed RSSFeed
 
-	if err := xml.Unmarshal(b, &feed); err != nil {
-		return nil, err
+	// posts are only announced once committed, so subscribers can load them
+	for _, post := range stored {
+		if post.Inserted {
+			fmt.Printf("Post created: %s %s\n", post.Title, post.Url)
+			announcePost(s, post)
+			s.webhooks.dispatch(ctx, s, next_feed, post)
+		} else {
+			fmt.Printf("Post updated: %s %s\n", post.Title, post.Url)
+		}
 	}
 
-	// unescape html strings
-	feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
-	feed.Channel.Description = html.UnescapeString(feed.Channel.Description)
-	for i := range feed.Channel.Item {
-		feed.Channel.Item[i].Title = html.UnescapeString(feed.Channel.Item[i].Title)
-		feed.Channel.Item[i].Description = html.UnescapeString(feed.Channel.Item[i].Description)
-	}
+	return nil
+}
 
-	return &feed, nil
+// markFeedFailed records err against feed so it is retried with backoff
+func markFeedFailed(s *state, feed database.Feed, err error) error {
+	markErr := s.db.MarkFeedFailed(context.Background(), database.MarkFeedFailedParams{
+		ID:            feed.ID,
+		LastFetchedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		LastError:     nullString(err.Error()),
+	})
+	if markErr != nil {
+		return errors.Join(err, markErr)
+	}
+	return err
 }
 
 func aggregationHandler(s *state, cmd command) error {
@@ -417,20 +550,79 @@ func aggregationHandler(s *state, cmd command) error {
 		return fmt.Errorf("invalid command")
 	}
 
-	// Check if the arguments are valid
-	if len(cmd.Args) < 1 {
-		return fmt.Errorf("missing duration arguments")
+	// --once fetches every due feed a single time and exits, for cron and systemd timers
+	once, args := popFlag(cmd.Args, "--once")
+
+	var time_between_reqs time.Duration
+	var err error
+	if !once {
+		// Check if the arguments are valid
+		if len(args) < 1 {
+			return fmt.Errorf("missing duration arguments")
+		}
+
+		time_between_reqs, err = time.ParseDuration(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid duration: %v", err)
+		}
+		args = args[1:]
 	}
 
-	// name := cmd.Args[0]
-	time_between_reqs, err := time.ParseDuration(cmd.Args[0])
-	if err != nil {
-		return fmt.Errorf("invalid duration: %v", err)
+	// number of feeds fetched in parallel per tick
+	workers := 1
+	if len(args) >= 1 {
+		workers, err = strconv.Atoi(args[0])
+		if err != nil || workers < 1 {
+			return fmt.Errorf("invalid concurrency: %s", args[0])
+		}
 	}
 
-	ticker := time.NewTicker(time_between_reqs)
-	for ; ; <-ticker.C {
-		scrapeFeeds(s)
+	// SIGINT/SIGTERM cancel in-flight fetches; scrapeFeeds waits for its workers to finish writing
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// let webhook deliveries finish before exiting; a signal drops their pending retries
+	defer s.webhooks.wait()
+
+	if once {
+		start := time.Now()
+		for {
+			claimed, err := scrapeFeeds(ctx, s, workers, start)
+			if ctx.Err() != nil {
+				fmt.Println("Shutting down")
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if claimed == 0 {
+				return pruneAfterAgg(ctx, s)
+			}
+		}
+	}
+
+	aggregate(ctx, s, time_between_reqs, workers)
+	fmt.Println("Shutting down")
+	return nil
+}
+
+// aggregate fetches the due feeds every interval until ctx is done
+func aggregate(ctx context.Context, s *state, interval time.Duration, workers int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := scrapeFeeds(ctx, s, workers, time.Now()); err != nil && ctx.Err() == nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		if err := pruneAfterAgg(ctx, s); err != nil && ctx.Err() == nil {
+			fmt.Printf("Error pruning posts: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 }
 
@@ -440,26 +632,48 @@ func browseHandler(s *state, cmd command, user database.User) error {
 		return fmt.Errorf("invalid command")
 	}
 
+	// --unread hides posts that were already read
+	unread, args := popFlag(cmd.Args, "--unread")
+
 	var limit int = 2
 	var err error
 
 	// Check if the arguments are valid
-	if len(cmd.Args) >= 1 {
-		limit, err = strconv.Atoi(cmd.Args[0])
+	if len(args) >= 1 {
+		limit, err = strconv.Atoi(args[0])
 		if err != nil {
 			return err
 		}
 	}
 
-	// name := cmd.Args[0]
+	var posts []database.GetPostsForUserRow
+	if unread {
+		counts, err := s.db.GetUnreadCountsForUser(context.Background(), user.ID)
+		if err != nil {
+			return err
+		}
+		for _, count := range counts {
+			if count.Unread > 0 {
+				fmt.Printf("%s: %d unread\n", count.FeedName, count.Unread)
+			}
+		}
 
-	posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{UserID: user.ID, Limit: int32(limit)})
-	if err != nil {
-		return err
+		rows, err := s.db.GetUnreadPostsForUser(context.Background(), database.GetUnreadPostsForUserParams{UserID: user.ID, Limit: int32(limit)})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			posts = append(posts, database.GetPostsForUserRow(row))
+		}
+	} else {
+		posts, err = s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{UserID: user.ID, Limit: int32(limit)})
+		if err != nil {
+			return err
+		}
 	}
 
 	for _, post := range posts {
-		fmt.Printf("* %s, ", post.Title)
+		fmt.Printf("* %s %s, ", post.ID, post.Title)
 		fmt.Printf("  %s, ", post.Url)
 		fmt.Printf("%s \n", post.PublishedAt.Format(time.RFC3339))
 	}
@@ -474,6 +688,9 @@ func parseTime(timeStr string) (time.Time, error) {
 		time.RFC3339,
 		"2006-01-02T15:04:05Z",
 		"Mon, 02 Jan 2006 15:04:05 -0700",
+		// W3C date formats used by dc:date in RSS 1.0
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02",
 		// Add more formats as needed
 	}
 
@@ -491,10 +708,65 @@ func parseTime(timeStr string) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("could not parse time: %s", timeStr)
 }
 
+func nullString(str string) sql.NullString {
+	return sql.NullString{String: str, Valid: str != ""}
+}
+
+// popFlag reports whether the boolean flag name appears in args and returns the remaining args
+func popFlag(args []string, name string) (bool, []string) {
+	rest := make([]string, 0, len(args))
+	found := false
+	for _, arg := range args {
+		if arg == name {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return found, rest
+}
+
+// popFlagValue removes "name value" from args and returns the value, or "" when the flag is absent
+func popFlagValue(args []string, name string) (string, []string, error) {
+	for i, arg := range args {
+		if arg != name {
+			continue
+		}
+		if i+1 >= len(args) {
+			return "", args, fmt.Errorf("missing value for %s", name)
+		}
+		rest := append(append([]string{}, args[:i]...), args[i+2:]...)
+		return args[i+1], rest, nil
+	}
+	return "", args, nil
+}
+
+// isUniqueViolation reports whether err is the database rejecting a duplicate row
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return false
+}
+
 func middlewareLoggedIn(handler func(s *state, cmd command, user database.User) error) func(*state, command) error {
 	return func(s *state, cmd command) error {
+		if s.Config.SessionToken == "" {
+			return fmt.Errorf("not logged in, run login <name>")
+		}
 
-		user, err := s.db.GetUserByName(context.Background(), s.Config.User)
+		user, err := s.db.GetUserBySession(context.Background(), database.GetUserBySessionParams{
+			TokenHash: hashToken(s.Config.SessionToken),
+			ExpiresAt: time.Now(),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("session expired, run login %s", s.Config.User)
+		}
 		if err != nil {
 			return err
 		}
@@ -503,6 +775,43 @@ func middlewareLoggedIn(handler func(s *state, cmd command, user database.User)
 	}
 }
 
+// newCommands registers every command gator understands
+func newCommands() commands {
+	commands := make(commands)
+	commands.register("login", loginHandler)
+	commands.register("register", registerHandler)
+	commands.register("reset", resetHandler)
+	commands.register("users", listUsersHandler)
+	commands.register("agg", aggregationHandler)
+	commands.register("addfeed", middlewareLoggedIn(addFeedHandler))
+	commands.register("feeds", listFeedsHandler)
+	commands.register("follow", middlewareLoggedIn(followHandler))
+	commands.register("following", middlewareLoggedIn(followingHandler))
+	commands.register("unfollow", middlewareLoggedIn(unfollowHandler))
+	commands.register("browse", middlewareLoggedIn(browseHandler))
+	commands.register("import", middlewareLoggedIn(importHandler))
+	commands.register("export", middlewareLoggedIn(exportHandler))
+	commands.register("read", middlewareLoggedIn(readHandler))
+	commands.register("mark-all-read", middlewareLoggedIn(markAllReadHandler))
+	commands.register("star", middlewareLoggedIn(starHandler))
+	commands.register("unstar", middlewareLoggedIn(starHandler))
+	commands.register("saved", middlewareLoggedIn(savedHandler))
+	commands.register("search", middlewareLoggedIn(searchHandler))
+	commands.register("serve", serveHandler)
+	commands.register("rotate-key", middlewareLoggedIn(rotateKeyHandler))
+	commands.register("passwd", middlewareLoggedIn(passwdHandler))
+	commands.register("render-feed", middlewareLoggedIn(renderFeedHandler))
+	commands.register("fever-password", middlewareLoggedIn(feverPasswordHandler))
+	commands.register("webhook-add", middlewareLoggedIn(addWebhookHandler))
+	commands.register("webhooks", middlewareLoggedIn(listWebhooksHandler))
+	commands.register("webhook-remove", middlewareLoggedIn(removeWebhookHandler))
+	commands.register("migrate", migrateHandler)
+	commands.register("prune", pruneHandler)
+	commands.register("retention", middlewareLoggedIn(retentionHandler))
+
+	return commands
+}
+
 func main() {
 	cfg, err := config.Read()
 	if err != nil {
@@ -510,34 +819,26 @@ func main() {
 	}
 
 	state := &state{
-		Config: &cfg,
+		Config:   &cfg,
+		hub:      newPostHub(),
+		webhooks: newWebhookSender(&http.Client{Timeout: webhookTimeout}),
 	}
 
-	db, err := sql.Open("postgres", cfg.DBUrl)
+	db, store, dialect, err := openStore(cfg.DBUrl)
 	if err != nil {
 		panic(err)
 	}
 	defer db.Close()
 
-	dbQueries := database.New(db)
-	state.db = dbQueries
+	state.db = store
+	state.conn = db
+	state.dialect = dialect
 
-	commands := make(commands)
-	commands.register("login", loginHandler)
-	commands.register("register", registerHandler)
-	commands.register("reset", resetHandler)
-	commands.register("users", listUsersHandler)
-	commands.register("agg", aggregationHandler)
-	commands.register("addfeed", middlewareLoggedIn(addFeedHandler))
-	commands.register("feeds", listFeedsHandler)
-	commands.register("follow", middlewareLoggedIn(followHandler))
-	commands.register("following", middlewareLoggedIn(followingHandler))
-	commands.register("unfollow", middlewareLoggedIn(unfollowHandler))
-	commands.register("browse", middlewareLoggedIn(browseHandler))
+	commands := newCommands()
 
 	args := os.Args
 	if len(args) < 2 {
-		fmt.Println("Usage: gator <command> [args]")
+		fmt.Fprintln(os.Stderr, "Usage: gator <command> [args]")
 		os.Exit(1)
 	}
 
@@ -546,11 +847,20 @@ func main() {
 		Args:    args[2:],
 	}
 
+	// every other command needs the schema its queries were generated against
+	if cmd.Command != "migrate" {
+		if err := checkSchema(context.Background(), db, dialect); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// status goes to stderr so that e.g. export > subs.opml is a valid document
 	err = commands.run(state, cmd)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Println("Command executed successfully")
+	fmt.Fprintln(os.Stderr, "Command executed successfully")
 
 }
@@ -0,0 +1,661 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"internal/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jsleep/blog_aggregator/internal/database"
+	"github.com/jsleep/blog_aggregator/internal/memdb"
+)
+
+// ranCommands records every command the tests ran, so TestMain can insist
+// each registered command is covered
+var ranCommands sync.Map
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+
+	// only a full run is expected to reach every command
+	if code == 0 && flag.Lookup("test.run").Value.String() == "" {
+		var missing []string
+		for name := range newCommands() {
+			if _, ok := ranCommands.Load(name); !ok {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			slices.Sort(missing)
+			fmt.Printf("commands without tests: %s\n", strings.Join(missing, ", "))
+			code = 1
+		}
+	}
+
+	os.Exit(code)
+}
+
+// newTestState returns a state on an empty in-memory store, with the config
+// file kept in a temporary home directory
+func newTestState(t *testing.T) *state {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	webhooks := newWebhookSender(&http.Client{Timeout: time.Second})
+	webhooks.retryDelay = time.Millisecond
+
+	return &state{
+		Config:   &config.Config{},
+		db:       memdb.New(),
+		hub:      newPostHub(),
+		webhooks: webhooks,
+	}
+}
+
+// setStdin feeds input to the prompts of the next commands
+func setStdin(t *testing.T, input string) {
+	t.Helper()
+	previous := stdin
+	stdin = bufio.NewReader(strings.NewReader(input))
+	t.Cleanup(func() { stdin = previous })
+}
+
+// run executes a command the way main does and returns what it printed
+func run(t *testing.T, s *state, name string, args ...string) (string, error) {
+	t.Helper()
+	ranCommands.Store(name, true)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	printed := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		printed <- string(b)
+	}()
+
+	cmds := newCommands()
+	err = cmds.run(s, command{Command: name, Args: args})
+	w.Close()
+	return <-printed, err
+}
+
+// mustRun is run for commands that are expected to succeed
+func mustRun(t *testing.T, s *state, name string, args ...string) string {
+	t.Helper()
+	out, err := run(t, s, name, args...)
+	if err != nil {
+		t.Fatalf("%s %s: %v\n%s", name, strings.Join(args, " "), err, out)
+	}
+	return out
+}
+
+// registerUser registers name without a password, which also logs them in
+func registerUser(t *testing.T, s *state, name string) database.User {
+	t.Helper()
+	setStdin(t, "\n")
+	mustRun(t, s, "register", name)
+
+	user, err := s.db.GetUserByName(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// feedServer serves an RSS feed whose items can change between fetches
+type feedServer struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	title string
+	items []RSSItem
+}
+
+func newFeedServer(t *testing.T, title string, items ...RSSItem) *feedServer {
+	t.Helper()
+	fs := &feedServer{title: title, items: items}
+	fs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+
+		doc := struct {
+			XMLName xml.Name `xml:"rss"`
+			Version string   `xml:"version,attr"`
+			RSSFeed
+		}{Version: "2.0"}
+		doc.Channel.Title = fs.title
+		doc.Channel.Link = fs.URL
+		doc.Channel.Item = fs.items
+
+		w.Header().Set("Content-Type", "application/rss+xml")
+		io.WriteString(w, xml.Header)
+		xml.NewEncoder(w).Encode(doc)
+	}))
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+func (fs *feedServer) setItems(items ...RSSItem) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.items = items
+}
+
+// testItem is the nth item of a feed, published n days after 2024-01-01
+func testItem(n int, title, description string) RSSItem {
+	return RSSItem{
+		Title:       title,
+		Link:        fmt.Sprintf("https://example.com/posts/%d", n),
+		Description: description,
+		PubDate:     time.Date(2024, 1, 1+n, 12, 0, 0, 0, time.UTC).Format(time.RFC1123Z),
+		GUID:        fmt.Sprintf("post-%d", n),
+	}
+}
+
+// addFeed adds and follows a feed served by fs, then fetches it once
+func addFeed(t *testing.T, s *state, name string, fs *feedServer) database.Feed {
+	t.Helper()
+	mustRun(t, s, "addfeed", name, fs.URL)
+	mustRun(t, s, "agg", "--once")
+
+	feed, err := s.db.GetFeed(context.Background(), fs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feed
+}
+
+// postIDs lists the user's posts, newest first
+func postIDs(t *testing.T, s *state, user database.User) []string {
+	t.Helper()
+	posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{UserID: user.ID, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, post := range posts {
+		ids = append(ids, post.ID.String())
+	}
+	return ids
+}
+
+// newAPIKey gives the logged in user a new API key and returns it
+func newAPIKey(t *testing.T, s *state) string {
+	t.Helper()
+	out := mustRun(t, s, "rotate-key")
+	line, _, _ := strings.Cut(out, "\n")
+	_, key, ok := strings.Cut(line, ": ")
+	if !ok || key == "" {
+		t.Fatalf("no key printed:\n%s", out)
+	}
+	return key
+}
+
+// apiRequest sends body to the REST API served by srv, authenticated with
+// apiKey unless it is empty, and decodes the JSON reply into v unless v is
+// nil. It returns the status code.
+func apiRequest(t *testing.T, srv *httptest.Server, method, path, apiKey, body string, v any) int {
+	t.Helper()
+	r, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apiKey != "" {
+		r.Header.Set("Authorization", "ApiKey "+apiKey)
+	}
+
+	resp, err := srv.Client().Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if v != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestUnknownCommand(t *testing.T) {
+	s := newTestState(t)
+	cmds := newCommands()
+	if err := cmds.run(s, command{Command: "nope"}); err == nil {
+		t.Fatal("expected an error for an unknown command")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	s := newTestState(t)
+	// a config file written by an older gator, readable by everyone
+	configPath := filepath.Join(os.Getenv("HOME"), ".gatorconfig.json")
+	if err := os.WriteFile(configPath, []byte(`{"db_url": "sqlite:gator.db"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	setStdin(t, "hunter22\nhunter22\n")
+	out := mustRun(t, s, "register", "alice")
+	if !strings.Contains(out, "API key: ") {
+		t.Errorf("register should print the api key, got:\n%s", out)
+	}
+
+	user, err := s.db.GetUserByName(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPassword(user, "hunter22"); err != nil {
+		t.Errorf("password not stored: %v", err)
+	}
+	if strings.Contains(out, user.PasswordHash.String) || strings.Contains(out, user.ApiKeyHash.String) {
+		t.Errorf("register printed a hash:\n%s", out)
+	}
+	// the session token is a secret too
+	info, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("config file mode %v, want -rw-------", info.Mode().Perm())
+	}
+
+	// registering logs the new user in
+	if s.Config.User != "alice" || s.Config.SessionToken == "" {
+		t.Errorf("register did not start a session: %+v", s.Config)
+	}
+	saved, err := config.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.SessionToken != s.Config.SessionToken {
+		t.Error("session was not written to the config file")
+	}
+
+	setStdin(t, "\n")
+	if _, err := run(t, s, "register", "alice"); !isUniqueViolation(err) {
+		t.Errorf("registering a taken name: got %v, want a unique violation", err)
+	}
+
+	setStdin(t, "one\ntwo\n")
+	if _, err := run(t, s, "register", "bob"); err == nil {
+		t.Error("expected mismatched passwords to fail")
+	}
+
+	if _, err := run(t, s, "register"); err == nil {
+		t.Error("expected an error without a name")
+	}
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestState(t)
+	registerUser(t, s, "alice")
+	setStdin(t, "secret\nsecret\n")
+	mustRun(t, s, "register", "bob")
+	bobToken := s.Config.SessionToken
+
+	// alice has no password
+	mustRun(t, s, "login", "alice")
+	if s.Config.User != "alice" {
+		t.Fatalf("logged in as %s, want alice", s.Config.User)
+	}
+	// the previous session is replaced, not kept alongside
+	if _, err := s.db.GetUserBySession(context.Background(), database.GetUserBySessionParams{
+		TokenHash: hashToken(bobToken),
+		ExpiresAt: time.Now(),
+	}); err == nil {
+		t.Error("bob's session should have been deleted")
+	}
+
+	setStdin(t, "wrong\n")
+	if _, err := run(t, s, "login", "bob"); err == nil || s.Config.User != "alice" {
+		t.Errorf("login with a wrong password: err %v, user %s", err, s.Config.User)
+	}
+
+	setStdin(t, "secret\n")
+	mustRun(t, s, "login", "bob")
+	if s.Config.User != "bob" {
+		t.Errorf("logged in as %s, want bob", s.Config.User)
+	}
+
+	if _, err := run(t, s, "login", "carol"); err == nil {
+		t.Error("expected an error for an unknown user")
+	}
+}
+
+func TestLoggedInCommandsNeedASession(t *testing.T) {
+	s := newTestState(t)
+	if _, err := run(t, s, "following"); err == nil {
+		t.Fatal("expected following to fail without a session")
+	}
+
+	registerUser(t, s, "alice")
+	s.Config.SessionToken = "forged"
+	if _, err := run(t, s, "following"); err == nil || !strings.Contains(err.Error(), "session expired") {
+		t.Fatalf("expected an expired session, got %v", err)
+	}
+}
+
+func TestUsersAndReset(t *testing.T) {
+	s := newTestState(t)
+	registerUser(t, s, "alice")
+	bob := registerUser(t, s, "bob")
+	fs := newFeedServer(t, "Bob's blog", testItem(1, "Hello", "first"))
+	addFeed(t, s, "Bob's blog", fs)
+
+	out := mustRun(t, s, "users")
+	if !strings.Contains(out, "* alice\n") || !strings.Contains(out, "* bob (current)\n") {
+		t.Errorf("unexpected users output:\n%s", out)
+	}
+
+	mustRun(t, s, "reset")
+
+	users, err := s.db.GetUsers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Errorf("reset left %d users", len(users))
+	}
+	// feeds and their posts belong to the user who added them
+	feeds, err := s.db.GetFeeds(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 0 {
+		t.Errorf("reset left %d feeds", len(feeds))
+	}
+	if n, _ := s.db.CountPostsForUser(context.Background(), bob.ID); n != 0 {
+		t.Errorf("reset left %d posts", n)
+	}
+}
+
+func TestAddFeed(t *testing.T) {
+	s := newTestState(t)
+	alice := registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "Hello", "first"))
+
+	// a page advertising its feed is resolved to the feed itself
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><head><link rel="alternate" type="application/rss+xml" title="Example" href="%s"></head></html>`, fs.URL)
+	}))
+	defer page.Close()
+
+	out := mustRun(t, s, "addfeed", "Example", page.URL)
+	if !strings.Contains(out, "Found feed "+fs.URL) {
+		t.Errorf("expected the discovered feed to be reported:\n%s", out)
+	}
+
+	feed, err := s.db.GetFeed(context.Background(), fs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.UserID != alice.ID {
+		t.Error("feed should belong to the user who added it")
+	}
+	follows, err := s.db.GetFeedFollowsForUser(context.Background(), alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(follows) != 1 || follows[0].FeedID != feed.ID {
+		t.Errorf("the user should follow the feed they added, got %+v", follows)
+	}
+
+	// the name is unique too; the failed follow must not leave a feed behind
+	other := newFeedServer(t, "Other")
+	if _, err := run(t, s, "addfeed", "Example", other.URL); !isUniqueViolation(err) {
+		t.Errorf("adding a taken name: got %v, want a unique violation", err)
+	}
+	if _, err := s.db.GetFeed(context.Background(), other.URL); err == nil {
+		t.Error("a failed addfeed left its feed behind")
+	}
+
+	// a site that can't be checked right now is added as given, for agg to retry
+	forbidden := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no bots", http.StatusForbidden)
+	}))
+	defer forbidden.Close()
+	out = mustRun(t, s, "addfeed", "Forbidden", forbidden.URL)
+	if !strings.Contains(out, "Warning: could not find a feed at "+forbidden.URL) {
+		t.Errorf("expected a warning:\n%s", out)
+	}
+	if _, err := s.db.GetFeed(context.Background(), forbidden.URL); err != nil {
+		t.Errorf("a feed that couldn't be checked was not added: %v", err)
+	}
+
+	// but a page that was fetched and leads to no feed is an error
+	homepage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<html><head><title>Just a homepage</title></head><body></body></html>`)
+	}))
+	defer homepage.Close()
+	if _, err := run(t, s, "addfeed", "Homepage", homepage.URL); err == nil || !strings.Contains(err.Error(), "no feed found") {
+		t.Errorf("adding a page without a feed: got %v", err)
+	}
+	if _, err := s.db.GetFeed(context.Background(), homepage.URL); err == nil {
+		t.Error("a page without a feed was added")
+	}
+
+	if _, err := run(t, s, "addfeed", "Example"); err == nil {
+		t.Error("expected an error without a url")
+	}
+}
+
+func TestFollowUnfollowFollowing(t *testing.T) {
+	s := newTestState(t)
+	registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"), testItem(2, "Two", "second"))
+	feed := addFeed(t, s, "Example", fs)
+
+	bob := registerUser(t, s, "bob")
+	out := mustRun(t, s, "follow", feed.Url)
+	if !strings.Contains(out, "User bob followed feed Example") {
+		t.Errorf("unexpected follow output:\n%s", out)
+	}
+	if _, err := run(t, s, "follow", feed.Url); !isUniqueViolation(err) {
+		t.Errorf("following twice: got %v, want a unique violation", err)
+	}
+	if _, err := run(t, s, "follow", "https://example.com/missing.xml"); err == nil {
+		t.Error("expected an error following an unknown feed")
+	}
+
+	out = mustRun(t, s, "following")
+	if !strings.Contains(out, "* Example (2 unread)") {
+		t.Errorf("unexpected following output:\n%s", out)
+	}
+
+	mustRun(t, s, "unfollow", feed.Url)
+	follows, err := s.db.GetFeedFollowsForUser(context.Background(), bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(follows) != 0 {
+		t.Errorf("unfollow left %d follows", len(follows))
+	}
+	out = mustRun(t, s, "following")
+	if strings.Contains(out, "Example") {
+		t.Errorf("unfollowed feed still listed:\n%s", out)
+	}
+}
+
+func TestFeeds(t *testing.T) {
+	s := newTestState(t)
+	registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"))
+	addFeed(t, s, "Example", fs)
+
+	out := mustRun(t, s, "feeds")
+	if !strings.Contains(out, "* Example, ") || !strings.Contains(out, fs.URL) || !strings.Contains(out, "alice") {
+		t.Errorf("unexpected feeds output:\n%s", out)
+	}
+
+	// a feed that stops answering is reported as failing
+	fs.Close()
+	feed, err := s.db.GetFeed(context.Background(), fs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scrapeFeed(context.Background(), s, feed); err == nil {
+		t.Fatal("expected fetching a closed server to fail")
+	}
+	out = mustRun(t, s, "feeds")
+	if !strings.Contains(out, "failing (1 in a row)") {
+		t.Errorf("failing feed not reported:\n%s", out)
+	}
+}
+
+func TestAgg(t *testing.T) {
+	s := newTestState(t)
+	alice := registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"), testItem(2, "Two", "second"))
+	mustRun(t, s, "addfeed", "Example", fs.URL)
+
+	out := mustRun(t, s, "agg", "--once")
+	if strings.Count(out, "Post created: ") != 2 {
+		t.Errorf("expected two new posts:\n%s", out)
+	}
+	if got := len(postIDs(t, s, alice)); got != 2 {
+		t.Fatalf("stored %d posts, want 2", got)
+	}
+
+	// agg --once doesn't fetch a feed again until the next run
+	fs.setItems(testItem(1, "One (edited)", "first"), testItem(2, "Two", "second"), testItem(3, "Three", "third"))
+	out = mustRun(t, s, "agg", "--once", "4")
+	if !strings.Contains(out, "Post updated: One (edited)") || !strings.Contains(out, "Post created: Three") {
+		t.Errorf("expected one updated and one new post:\n%s", out)
+	}
+	if strings.Contains(out, "Two") && strings.Contains(out, "Post created: Two") {
+		t.Errorf("an unchanged post was stored again:\n%s", out)
+	}
+	if got := len(postIDs(t, s, alice)); got != 3 {
+		t.Errorf("stored %d posts, want 3", got)
+	}
+
+	for _, args := range [][]string{{}, {"soon"}, {"1s", "0"}} {
+		if _, err := run(t, s, "agg", args...); err == nil {
+			t.Errorf("agg %v: expected an error", args)
+		}
+	}
+}
+
+func TestAggBacksOffFailingFeeds(t *testing.T) {
+	s := newTestState(t)
+	registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example")
+	mustRun(t, s, "addfeed", "Example", fs.URL)
+	fs.Close()
+
+	mustRun(t, s, "agg", "--once")
+	feed, err := s.db.GetFeed(context.Background(), fs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.ErrorCount != 1 || !feed.LastError.Valid {
+		t.Fatalf("failure not recorded: %+v", feed)
+	}
+
+	// the failed feed waits out its backoff rather than being claimed again
+	claimed, err := scrapeFeeds(context.Background(), s, 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed != 0 {
+		t.Errorf("claimed %d feeds during backoff", claimed)
+	}
+}
+
+func TestAggTimesOutHangingFeeds(t *testing.T) {
+	s := newTestState(t)
+	registerUser(t, s, "alice")
+
+	// accepts the connection, then never answers
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer hanging.Close()
+	defer close(release)
+
+	previous := feedClient
+	feedClient = &http.Client{Timeout: 50 * time.Millisecond}
+	t.Cleanup(func() { feedClient = previous })
+
+	out := mustRun(t, s, "addfeed", "Hanging", hanging.URL)
+	if !strings.Contains(out, "adding it as given") {
+		t.Errorf("unexpected addfeed output:\n%s", out)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := run(t, s, "agg", "--once"); err != nil {
+			t.Errorf("agg: %v", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("agg is stuck on a feed that never answers")
+	}
+
+	feed, err := s.db.GetFeed(context.Background(), hanging.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.ErrorCount != 1 || !feed.LastError.Valid {
+		t.Errorf("the timeout was not recorded as a failure: %+v", feed)
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	s := newTestState(t)
+	registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"), testItem(2, "Two", "second"), testItem(3, "Three", "third"))
+	addFeed(t, s, "Example", fs)
+
+	// newest first, two by default
+	out := mustRun(t, s, "browse")
+	if strings.Count(out, "* ") != 2 || strings.Index(out, "Three") > strings.Index(out, "Two") || strings.Contains(out, "One") {
+		t.Errorf("unexpected browse output:\n%s", out)
+	}
+
+	out = mustRun(t, s, "browse", "10")
+	if strings.Count(out, "* ") != 3 {
+		t.Errorf("expected all three posts:\n%s", out)
+	}
+
+	three := strings.Fields(out)[1]
+	mustRun(t, s, "read", three)
+	out = mustRun(t, s, "browse", "--unread", "10")
+	if strings.Contains(out, "Three") || !strings.Contains(out, "Example: 2 unread") {
+		t.Errorf("unexpected unread browse output:\n%s", out)
+	}
+
+	if _, err := run(t, s, "browse", "many"); err == nil {
+		t.Error("expected an error for a non-numeric limit")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"time"
+
+	"github.com/pressly/goose/v3"
+)
+
+// schemaFS is compiled into the binary so gator can migrate its own database
+//
+//go:embed sql/schema/*.sql sql/sqlite/schema/*.sql
+var schemaFS embed.FS
+
+func newMigrationProvider(db *sql.DB, dialect goose.Dialect) (*goose.Provider, error) {
+	dir := "sql/schema"
+	if dialect == goose.DialectSQLite3 {
+		dir = "sql/sqlite/schema"
+	}
+	migrations, err := fs.Sub(schemaFS, dir)
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(dialect, db, migrations)
+}
+
+func migrateHandler(s *state, cmd command) error {
+	// Check if the command is "migrate"
+	if cmd.Command != "migrate" {
+		return fmt.Errorf("invalid command")
+	}
+
+	// Check if the arguments are valid
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("missing up/down/status argument")
+	}
+
+	provider, err := newMigrationProvider(s.conn, s.dialect)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch cmd.Args[0] {
+	case "up":
+		results, err := provider.Up(ctx)
+		for _, result := range results {
+			printMigrationResult(result)
+		}
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+
+	case "down":
+		result, err := provider.Down(ctx)
+		if result != nil {
+			printMigrationResult(result)
+		}
+		if err != nil {
+			return err
+		}
+
+	case "status":
+		statuses, err := provider.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.State == goose.StateApplied {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("* %s: %s\n", path.Base(status.Source.Path), applied)
+		}
+
+	default:
+		return fmt.Errorf("unknown migrate command %s, expected up, down or status", cmd.Args[0])
+	}
+
+	return nil
+}
+
+func printMigrationResult(result *goose.MigrationResult) {
+	if result.Error != nil {
+		fmt.Printf("* %s %s failed: %v\n", result.Direction, path.Base(result.Source.Path), result.Error)
+		return
+	}
+	fmt.Printf("* %s %s (%s)\n", result.Direction, path.Base(result.Source.Path), result.Duration.Round(time.Millisecond))
+}
+
+// checkSchema refuses to run against a database whose schema doesn't match
+// the queries compiled into this binary
+func checkSchema(ctx context.Context, db *sql.DB, dialect goose.Dialect) error {
+	provider, err := newMigrationProvider(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	current, target, err := provider.GetVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("could not read schema version: %w", err)
+	}
+	if current > target {
+		return fmt.Errorf("database schema version %d is newer than this gator (%d), upgrade gator", current, target)
+	}
+
+	pending, err := provider.HasPending(ctx)
+	if err != nil {
+		return fmt.Errorf("could not read schema version: %w", err)
+	}
+	if pending {
+		return fmt.Errorf("database schema version %d is out of date (want %d), run: gator migrate up", current, target)
+	}
+
+	return nil
+}
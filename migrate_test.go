@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+func TestMigrate(t *testing.T) {
+	s := newTestState(t)
+	conn, store, dialect, err := openStore("sqlite:" + filepath.Join(t.TempDir(), "gator.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s.conn, s.db, s.dialect = conn, store, dialect
+	ctx := context.Background()
+
+	if err := checkSchema(ctx, conn, dialect); err == nil || !strings.Contains(err.Error(), "gator migrate up") {
+		t.Errorf("an empty database passed the schema check: %v", err)
+	}
+
+	out := mustRun(t, s, "migrate", "status")
+	if !strings.Contains(out, ": pending") || strings.Contains(out, ": applied") {
+		t.Errorf("unexpected status before migrating:\n%s", out)
+	}
+
+	out = mustRun(t, s, "migrate", "up")
+	if !strings.Contains(out, "* up ") {
+		t.Errorf("unexpected migrate up output:\n%s", out)
+	}
+	if err := checkSchema(ctx, conn, dialect); err != nil {
+		t.Errorf("schema check after migrating: %v", err)
+	}
+	if out := mustRun(t, s, "migrate", "up"); !strings.Contains(out, "Schema is up to date") {
+		t.Errorf("unexpected second migrate up output:\n%s", out)
+	}
+
+	// the migrated database works with the commands
+	registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"))
+	addFeed(t, s, "Example", fs)
+
+	out = mustRun(t, s, "migrate", "down")
+	if !strings.Contains(out, "* down ") {
+		t.Errorf("unexpected migrate down output:\n%s", out)
+	}
+	out = mustRun(t, s, "migrate", "status")
+	if !strings.Contains(out, ": pending") {
+		t.Errorf("unexpected status after migrating down:\n%s", out)
+	}
+	if err := checkSchema(ctx, conn, dialect); err == nil {
+		t.Error("a rolled back database passed the schema check")
+	}
+
+	if _, err := run(t, s, "migrate"); err == nil {
+		t.Error("expected an error without a subcommand")
+	}
+	if _, err := run(t, s, "migrate", "sideways"); err == nil {
+		t.Error("expected an error for an unknown subcommand")
+	}
+}
+
+// addLegacyPost stores a post the way gator did before guids were tracked:
+// keyed by its url, without a content hash
+func addLegacyPost(t *testing.T, s *state, feed database.Feed, item RSSItem) database.CreatePostRow {
+	t.Helper()
+	published, err := parseTime(item.PubDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := s.db.CreatePost(context.Background(), database.CreatePostParams{
+		ID:          uuid.New(),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+		PublishedAt: published,
+		Url:         item.Link,
+		FeedID:      feed.ID,
+		Title:       item.Title,
+		Description: item.Description,
+		Guid:        item.Link,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+func TestAggAdoptsLegacyPosts(t *testing.T) {
+	t.Run("memdb", func(t *testing.T) { testAggAdoptsLegacyPosts(t, newTestState(t)) })
+	t.Run("sqlite", func(t *testing.T) { testAggAdoptsLegacyPosts(t, newSQLiteState(t)) })
+}
+
+func testAggAdoptsLegacyPosts(t *testing.T, s *state) {
+	alice := registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"), testItem(2, "Two", "second"))
+	mustRun(t, s, "addfeed", "Example", fs.URL)
+	feed, err := s.db.GetFeed(context.Background(), fs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := addLegacyPost(t, s, feed, testItem(1, "One", "first"))
+
+	// the item's guid differs from its link, yet it is the same post
+	out := mustRun(t, s, "agg", "--once")
+	if !strings.Contains(out, "Post updated: One") || !strings.Contains(out, "Post created: Two") {
+		t.Errorf("unexpected agg output:\n%s", out)
+	}
+	if got := postTitles(t, s, alice); !slices.Equal(got, []string{"Two", "One"}) {
+		t.Fatalf("stored %v", got)
+	}
+	post, err := s.db.GetPost(context.Background(), legacy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Guid != "post-1" || post.ContentHash == "" {
+		t.Errorf("legacy post not moved onto its guid: %+v", post)
+	}
+
+	if out := mustRun(t, s, "agg", "--once"); strings.Contains(out, "Post ") {
+		t.Errorf("posts stored again:\n%s", out)
+	}
+}
+
+// TestMigratePostGUIDs upgrades a Postgres database holding posts stored
+// before guids were tracked. It needs an empty database it may wipe, named by
+// GATOR_TEST_POSTGRES_URL.
+func TestMigratePostGUIDs(t *testing.T) {
+	dbURL := os.Getenv("GATOR_TEST_POSTGRES_URL")
+	if dbURL == "" {
+		t.Skip("GATOR_TEST_POSTGRES_URL is not set")
+	}
+	ctx := context.Background()
+
+	s := newTestState(t)
+	conn, store, dialect, err := openStore(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	provider, err := newMigrationProvider(conn, dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 007 is the last schema without guids
+	if _, err := provider.UpTo(ctx, 7); err != nil {
+		t.Fatal(err)
+	}
+	defer provider.DownTo(ctx, 0)
+
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"), testItem(2, "Two", "second"))
+	one := testItem(1, "One", "first")
+	published, err := parseTime(one.PubDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, feedID, postID, now := uuid.New(), uuid.New(), uuid.New(), time.Now()
+	for _, stmt := range []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT INTO users (id, name, created_at, updated_at) VALUES ($1, 'alice', $2, $2)`, []any{userID, now}},
+		{`INSERT INTO feeds (id, name, url, created_at, updated_at, user_id) VALUES ($1, 'Example', $2, $3, $3, $4)`, []any{feedID, fs.URL, now, userID}},
+		{`INSERT INTO feed_follows (id, created_at, user_id, feed_id) VALUES ($1, $2, $3, $4)`, []any{uuid.New(), now, userID, feedID}},
+		{`INSERT INTO posts (id, title, url, description, created_at, updated_at, published_at, feed_id)
+			VALUES ($1, $2, $3, $4, $5, $5, $6, $7)`, []any{postID, one.Title, one.Link, one.Description, now, published, feedID}},
+	} {
+		if _, err := conn.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := provider.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	s.conn, s.db, s.dialect = conn, store, dialect
+	mustRun(t, s, "login", "alice")
+
+	out := mustRun(t, s, "agg", "--once")
+	if !strings.Contains(out, "Post updated: One") || !strings.Contains(out, "Post created: Two") {
+		t.Errorf("unexpected agg output:\n%s", out)
+	}
+	user, err := s.db.GetUserByName(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := postTitles(t, s, user); !slices.Equal(got, []string{"Two", "One"}) {
+		t.Errorf("stored %v", got)
+	}
+	post, err := s.db.GetPost(ctx, postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Guid != "post-1" {
+		t.Errorf("migrated post has guid %q, want post-1", post.Guid)
+	}
+}
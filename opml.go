@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+// opmlDocument follows http://opml.org/spec2.opml
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated,omitempty"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []opmlOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Category string        `xml:"category,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlSubscription is a feed outline flattened out of its folders
+type opmlSubscription struct {
+	Name     string
+	URL      string
+	Category string
+}
+
+func importHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "import"
+	if cmd.Command != "import" {
+		return fmt.Errorf("invalid command")
+	}
+
+	// Check if the arguments are valid
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("missing opml file argument")
+	}
+
+	b, err := os.ReadFile(cmd.Args[0])
+	if err != nil {
+		return err
+	}
+
+	var doc opmlDocument
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("invalid opml: %v", err)
+	}
+
+	subs := flattenOutlines(doc.Body.Outlines, nil)
+
+	imported, skipped, failed := 0, 0, 0
+	for _, sub := range subs {
+		ok, err := importSubscription(s, user, sub)
+		switch {
+		case err != nil:
+			fmt.Printf("Error importing %s: %v\n", sub.URL, err)
+			failed++
+		case !ok:
+			skipped++
+		default:
+			fmt.Printf("* %s\n", sub.Name)
+			imported++
+		}
+	}
+
+	fmt.Printf("Imported %d feeds (%d already followed, %d failed)\n", imported, skipped, failed)
+
+	return nil
+}
+
+// errAlreadyFollowed rolls back the import of a feed the user already follows
+var errAlreadyFollowed = errors.New("already followed")
+
+// importSubscription follows sub, creating the feed first when nobody has
+// added its URL yet. It reports false if the user already follows the feed.
+// Each subscription gets its own transaction, so one bad outline neither
+// leaves an orphan feed nor undoes the rest of the import.
+func importSubscription(s *state, user database.User, sub opmlSubscription) (bool, error) {
+	err := s.db.InTx(context.Background(), func(q database.Querier) error {
+		feed, err := q.GetFeed(context.Background(), sub.URL)
+		if errors.Is(err, sql.ErrNoRows) {
+			feed, err = q.CreateFeed(context.Background(), database.CreateFeedParams{
+				ID:        uuid.New(),
+				Name:      sub.Name,
+				Url:       sub.URL,
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+				UserID:    user.ID,
+			})
+			// feed names are unique too, and outlines from different sites often share one
+			if isUniqueViolation(err) {
+				return fmt.Errorf("another feed is already named %s", sub.Name)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = q.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			FeedID:    feed.ID,
+			CreatedAt: time.Now(),
+			Category:  sub.Category,
+		})
+		if isUniqueViolation(err) {
+			return errAlreadyFollowed
+		}
+		return err
+	})
+	if errors.Is(err, errAlreadyFollowed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// flattenOutlines walks nested folders, recording each feed's folder path as its category
+func flattenOutlines(outlines []opmlOutline, folders []string) []opmlSubscription {
+	var subs []opmlSubscription
+	for _, outline := range outlines {
+		name := outline.Title
+		if name == "" {
+			name = outline.Text
+		}
+
+		if outline.XMLURL == "" {
+			subs = append(subs, flattenOutlines(outline.Outlines, append(folders[:len(folders):len(folders)], name))...)
+			continue
+		}
+
+		category := strings.Join(folders, "/")
+		// top level feeds may still carry an OPML 2.0 category attribute, e.g. "/Tech/Go"
+		if category == "" && outline.Category != "" {
+			category = strings.Trim(strings.Split(outline.Category, ",")[0], "/")
+		}
+		if name == "" {
+			name = outline.XMLURL
+		}
+
+		subs = append(subs, opmlSubscription{
+			Name:     name,
+			URL:      outline.XMLURL,
+			Category: category,
+		})
+	}
+	return subs
+}
+
+func exportHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "export"
+	if cmd.Command != "export" {
+		return fmt.Errorf("invalid command")
+	}
+
+	follows, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	var doc opmlDocument
+	doc.Version = "2.0"
+	doc.Head.Title = fmt.Sprintf("%s's gator subscriptions", user.Name)
+	doc.Head.DateCreated = time.Now().Format(time.RFC1123Z)
+
+	for _, follow := range follows {
+		outline := opmlOutline{
+			Text:   follow.FeedName,
+			Title:  follow.FeedName,
+			Type:   "rss",
+			XMLURL: follow.FeedUrl,
+		}
+		if follow.Category != "" {
+			outline.Category = "/" + follow.Category
+		}
+		doc.Body.Outlines = addToFolder(doc.Body.Outlines, strings.Split(follow.Category, "/"), outline)
+	}
+
+	// write to stdout unless a file was given
+	var w io.Writer = os.Stdout
+	if len(cmd.Args) >= 1 {
+		f, err := os.Create(cmd.Args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// addToFolder places outline under the nested folder path, creating folders as needed
+func addToFolder(outlines []opmlOutline, path []string, outline opmlOutline) []opmlOutline {
+	if len(path) == 0 || path[0] == "" {
+		return append(outlines, outline)
+	}
+
+	for i := range outlines {
+		if outlines[i].XMLURL == "" && outlines[i].Text == path[0] {
+			outlines[i].Outlines = addToFolder(outlines[i].Outlines, path[1:], outline)
+			return outlines
+		}
+	}
+
+	folder := opmlOutline{Text: path[0], Title: path[0]}
+	folder.Outlines = addToFolder(nil, path[1:], outline)
+	return append(outlines, folder)
+}
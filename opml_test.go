@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testOPML = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head><title>subscriptions</title></head>
+  <body>
+    <outline text="Tech">
+      <outline text="Go">
+        <outline text="Go Blog" type="rss" xmlUrl="https://go.dev/blog/feed.atom"/>
+      </outline>
+      <outline text="Lobsters" type="rss" xmlUrl="https://lobste.rs/rss"/>
+    </outline>
+    <outline text="News" type="rss" xmlUrl="https://example.com/news.xml" category="/World,/Daily"/>
+    <outline type="rss" xmlUrl="https://example.com/untitled.xml"/>
+  </body>
+</opml>
+`
+
+func TestImportExport(t *testing.T) {
+	s := newTestState(t)
+	alice := registerUser(t, s, "alice")
+	dir := t.TempDir()
+
+	in := filepath.Join(dir, "in.opml")
+	if err := os.WriteFile(in, []byte(testOPML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := mustRun(t, s, "import", in)
+	if !strings.Contains(out, "Imported 4 feeds (0 already followed, 0 failed)") {
+		t.Errorf("unexpected import output:\n%s", out)
+	}
+
+	follows, err := s.db.GetFeedFollowsForUser(context.Background(), alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	categories := map[string]string{}
+	for _, follow := range follows {
+		categories[follow.FeedName] = follow.Category
+	}
+	want := map[string]string{
+		"Go Blog":                          "Tech/Go",
+		"Lobsters":                         "Tech",
+		"News":                             "World",
+		"https://example.com/untitled.xml": "",
+	}
+	for name, category := range want {
+		if got, ok := categories[name]; !ok || got != category {
+			t.Errorf("%s: category %q (followed %v), want %q", name, got, ok, category)
+		}
+	}
+
+	// importing again skips what is already followed
+	out = mustRun(t, s, "import", in)
+	if !strings.Contains(out, "Imported 0 feeds (4 already followed, 0 failed)") {
+		t.Errorf("unexpected second import output:\n%s", out)
+	}
+
+	exported := filepath.Join(dir, "out.opml")
+	mustRun(t, s, "export", exported)
+	b, err := os.ReadFile(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `<outline text="Go" title="Go">`) {
+		t.Errorf("export lost the nested folders:\n%s", b)
+	}
+	// without a file the document goes to stdout, and nothing else does
+	stdout := mustRun(t, s, "export")
+	var doc opmlDocument
+	if !strings.HasPrefix(stdout, xml.Header) || xml.Unmarshal([]byte(stdout), &doc) != nil || len(doc.Body.Outlines) != 3 {
+		t.Errorf("stdout is not the exported document:\n%s", stdout)
+	}
+
+	// another user importing the export follows the same feeds, sharing them
+	bob := registerUser(t, s, "bob")
+	mustRun(t, s, "import", exported)
+	bobFollows, err := s.db.GetFeedFollowsForUser(context.Background(), bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bobFollows) != len(follows) {
+		t.Fatalf("bob follows %d feeds, want %d", len(bobFollows), len(follows))
+	}
+	for _, follow := range bobFollows {
+		if categories[follow.FeedName] != follow.Category {
+			t.Errorf("%s: category %q, want %q", follow.FeedName, follow.Category, categories[follow.FeedName])
+		}
+	}
+	feeds, err := s.db.GetFeeds(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 4 {
+		t.Errorf("import created duplicate feeds: %d", len(feeds))
+	}
+
+	// a different feed with a name that's taken fails instead of counting as followed
+	if err := os.WriteFile(in, []byte(`<opml version="2.0"><body>
+  <outline text="Blog" type="rss" xmlUrl="https://one.example.com/feed"/>
+  <outline text="Blog" type="rss" xmlUrl="https://two.example.com/feed"/>
+</body></opml>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out = mustRun(t, s, "import", in)
+	if !strings.Contains(out, "Imported 1 feeds (0 already followed, 1 failed)") || !strings.Contains(out, "Error importing https://two.example.com/feed: another feed is already named Blog") {
+		t.Errorf("unexpected import output for clashing names:\n%s", out)
+	}
+	if _, err := s.db.GetFeed(context.Background(), "https://two.example.com/feed"); err == nil {
+		t.Error("the failed import left its feed behind")
+	}
+
+	if _, err := run(t, s, "import"); err == nil {
+		t.Error("expected an error without a file")
+	}
+	if err := os.WriteFile(in, []byte("not xml"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(t, s, "import", in); err == nil {
+		t.Error("expected an error for an invalid document")
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+func readHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "read"
+	if cmd.Command != "read" {
+		return fmt.Errorf("invalid command")
+	}
+
+	// Check if the arguments are valid
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("missing post id argument")
+	}
+
+	post, err := getPostArg(s, user, cmd.Args[0])
+	if err != nil {
+		return err
+	}
+
+	err = s.db.MarkPostRead(context.Background(), database.MarkPostReadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+		ReadAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Marked %s as read\n", post.Title)
+
+	return nil
+}
+
+func markAllReadHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "mark-all-read"
+	if cmd.Command != "mark-all-read" {
+		return fmt.Errorf("invalid command")
+	}
+
+	params := database.MarkAllPostsReadParams{
+		UserID: user.ID,
+		ReadAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+
+	// optionally limit to a single feed, by url like follow/unfollow
+	if len(cmd.Args) >= 1 {
+		feed, err := s.db.GetFeed(context.Background(), cmd.Args[0])
+		if err != nil {
+			return err
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	marked, err := s.db.MarkAllPostsRead(context.Background(), params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Marked %d posts as read\n", marked)
+
+	return nil
+}
+
+// getPostArg looks up the post whose id was passed on the command line,
+// which must be from a feed the user follows
+func getPostArg(s *state, user database.User, arg string) (database.GetFollowedPostRow, error) {
+	id, err := uuid.Parse(arg)
+	if err != nil {
+		return database.GetFollowedPostRow{}, fmt.Errorf("invalid post id: %s", arg)
+	}
+
+	post, err := s.db.GetFollowedPost(context.Background(), database.GetFollowedPostParams{
+		ID:     id,
+		UserID: user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.GetFollowedPostRow{}, fmt.Errorf("post not found: %s", arg)
+	}
+	if err != nil {
+		return database.GetFollowedPostRow{}, err
+	}
+
+	return post, nil
+}
+
+// getStarredPostArg looks up a post the user starred by the id passed on the
+// command line; saved posts outlive the follow, so unstar can't require one
+func getStarredPostArg(s *state, user database.User, arg string) (database.Post, error) {
+	id, err := uuid.Parse(arg)
+	if err != nil {
+		return database.Post{}, fmt.Errorf("invalid post id: %s", arg)
+	}
+
+	post, err := s.db.GetStarredPost(context.Background(), database.GetStarredPostParams{
+		PostID: id,
+		UserID: user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Post{}, fmt.Errorf("saved post not found: %s", arg)
+	}
+	if err != nil {
+		return database.Post{}, err
+	}
+
+	return post, nil
+}
+
+func starHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "star" or "unstar"
+	if cmd.Command != "star" && cmd.Command != "unstar" {
+		return fmt.Errorf("invalid command")
+	}
+
+	// Check if the arguments are valid
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("missing post id argument")
+	}
+
+	starred := cmd.Command == "star"
+	var postID uuid.UUID
+	var title string
+	if starred {
+		post, err := getPostArg(s, user, cmd.Args[0])
+		if err != nil {
+			return err
+		}
+		postID, title = post.ID, post.Title
+	} else {
+		post, err := getStarredPostArg(s, user, cmd.Args[0])
+		if err != nil {
+			return err
+		}
+		postID, title = post.ID, post.Title
+	}
+
+	err := s.db.SetPostStarred(context.Background(), database.SetPostStarredParams{
+		UserID:    user.ID,
+		PostID:    postID,
+		Starred:   starred,
+		StarredAt: sql.NullTime{Time: time.Now(), Valid: starred},
+	})
+	if err != nil {
+		return err
+	}
+
+	if starred {
+		fmt.Printf("Saved %s\n", title)
+	} else {
+		fmt.Printf("Removed %s from saved posts\n", title)
+	}
+
+	return nil
+}
+
+func savedHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "saved"
+	if cmd.Command != "saved" {
+		return fmt.Errorf("invalid command")
+	}
+
+	var limit int = 10
+	var err error
+
+	// Check if the arguments are valid
+	if len(cmd.Args) >= 1 {
+		limit, err = strconv.Atoi(cmd.Args[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	posts, err := s.db.GetStarredPostsForUser(context.Background(), database.GetStarredPostsForUserParams{UserID: user.ID, Limit: int32(limit)})
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		fmt.Printf("* %s %s, ", post.ID, post.Title)
+		fmt.Printf("  %s, ", post.Url)
+		fmt.Printf("%s \n", post.FeedName)
+	}
+	return nil
+}
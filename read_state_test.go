@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+func TestRead(t *testing.T) {
+	s := newTestState(t)
+	alice := registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"), testItem(2, "Two", "second"))
+	addFeed(t, s, "Example", fs)
+	ids := postIDs(t, s, alice)
+
+	out := mustRun(t, s, "read", ids[0])
+	if !strings.Contains(out, "Marked Two as read") {
+		t.Errorf("unexpected read output:\n%s", out)
+	}
+	// reading again is harmless
+	mustRun(t, s, "read", ids[0])
+
+	unread, err := s.db.GetUnreadPostsForUser(context.Background(), database.GetUnreadPostsForUserParams{UserID: alice.ID, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unread) != 1 || unread[0].Title != "One" {
+		t.Errorf("unexpected unread posts: %+v", unread)
+	}
+
+	for _, args := range [][]string{{}, {"not-a-uuid"}, {"00000000-0000-0000-0000-000000000000"}} {
+		if _, err := run(t, s, "read", args...); err == nil {
+			t.Errorf("read %v: expected an error", args)
+		}
+	}
+
+	// posts from feeds someone else follows can't be looked up by id
+	registerUser(t, s, "bob")
+	if _, err := run(t, s, "read", ids[1]); err == nil || !strings.Contains(err.Error(), "post not found") {
+		t.Errorf("bob read alice's post: %v", err)
+	}
+}
+
+func TestMarkAllRead(t *testing.T) {
+	s := newTestState(t)
+	alice := registerUser(t, s, "alice")
+	one := newFeedServer(t, "One", testItem(1, "A", "a"), testItem(2, "B", "b"))
+	two := newFeedServer(t, "Two", testItem(3, "C", "c"))
+	addFeed(t, s, "One", one)
+	addFeed(t, s, "Two", two)
+
+	// limited to a single feed
+	out := mustRun(t, s, "mark-all-read", one.URL)
+	if !strings.Contains(out, "Marked 2 posts as read") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	counts, err := s.db.GetUnreadCountsForUser(context.Background(), alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 2 || counts[0].Unread != 0 || counts[1].Unread != 1 {
+		t.Errorf("unexpected unread counts: %+v", counts)
+	}
+
+	// posts already read aren't counted again
+	out = mustRun(t, s, "mark-all-read")
+	if !strings.Contains(out, "Marked 1 posts as read") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	if _, err := run(t, s, "mark-all-read", "https://example.com/unknown.xml"); err == nil {
+		t.Error("expected an error for an unknown feed")
+	}
+}
+
+func TestStarUnstarSaved(t *testing.T) {
+	s := newTestState(t)
+	alice := registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"), testItem(2, "Two", "second"))
+	feed := addFeed(t, s, "Example", fs)
+	ids := postIDs(t, s, alice)
+
+	out := mustRun(t, s, "star", ids[1])
+	if !strings.Contains(out, "Saved One") {
+		t.Errorf("unexpected star output:\n%s", out)
+	}
+	mustRun(t, s, "star", ids[0])
+
+	out = mustRun(t, s, "saved")
+	if strings.Count(out, "* ") != 2 || strings.Index(out, "Two") > strings.Index(out, "One") {
+		t.Errorf("saved should list the latest star first:\n%s", out)
+	}
+
+	out = mustRun(t, s, "unstar", ids[0])
+	if !strings.Contains(out, "Removed Two from saved posts") {
+		t.Errorf("unexpected unstar output:\n%s", out)
+	}
+
+	// starred posts stay saved after unfollowing their feed
+	mustRun(t, s, "unfollow", feed.Url)
+	out = mustRun(t, s, "saved", "5")
+	if strings.Count(out, "* ") != 1 || !strings.Contains(out, "One") {
+		t.Errorf("unexpected saved output:\n%s", out)
+	}
+
+	if _, err := run(t, s, "star", ids[0]); err == nil {
+		t.Error("expected an error starring a post from an unfollowed feed")
+	}
+	// but what is still saved can be unsaved
+	out = mustRun(t, s, "unstar", ids[1])
+	if !strings.Contains(out, "Removed One from saved posts") {
+		t.Errorf("unexpected unstar output after unfollowing:\n%s", out)
+	}
+	if out := mustRun(t, s, "saved"); strings.Contains(out, "* ") {
+		t.Errorf("the post is still saved:\n%s", out)
+	}
+	if _, err := run(t, s, "unstar", ids[1]); err == nil {
+		t.Error("expected an error unstarring a post that isn't saved")
+	}
+
+	if _, err := run(t, s, "star"); err == nil {
+		t.Error("expected an error without a post id")
+	}
+	if _, err := run(t, s, "unstar", "nope"); err == nil {
+		t.Error("expected an error for an invalid post id")
+	}
+	if _, err := run(t, s, "saved", "all"); err == nil {
+		t.Error("expected an error for a non-numeric limit")
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+// prunedFeed counts the posts prune removed from one feed
+type prunedFeed struct {
+	FeedID uuid.UUID
+	Name   string
+	Posts  int
+}
+
+func pruneHandler(s *state, cmd command) error {
+	// Check if the command is "prune"
+	if cmd.Command != "prune" {
+		return fmt.Errorf("invalid command")
+	}
+
+	// --dry-run reports what would be removed without deleting anything
+	dryRun, _ := popFlag(cmd.Args, "--dry-run")
+
+	pruned, err := prunePosts(context.Background(), s, time.Now(), dryRun)
+	if err != nil {
+		return err
+	}
+
+	if len(pruned) == 0 {
+		fmt.Println("No posts to prune")
+		return nil
+	}
+	printPruned(pruned, dryRun)
+
+	return nil
+}
+
+// prunePosts deletes the posts past their feed's retention and returns how
+// many went from each feed, or only counts them when dryRun is set
+func prunePosts(ctx context.Context, s *state, now time.Time, dryRun bool) ([]prunedFeed, error) {
+	var pruned []prunedFeed
+	err := s.db.InTx(ctx, func(q database.Querier) error {
+		rows, err := q.GetPrunablePosts(ctx, database.GetPrunablePostsParams{
+			DefaultMaxAgeDays: s.Config.Retention.MaxAgeDays,
+			DefaultMaxPosts:   s.Config.Retention.MaxPosts,
+			Now:               now,
+		})
+		if err != nil {
+			return err
+		}
+
+		// rows come sorted by feed name, which is the order they're reported in
+		index := map[uuid.UUID]int{}
+		ids := make([]uuid.UUID, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, row.ID)
+			if _, ok := index[row.FeedID]; !ok {
+				index[row.FeedID] = len(pruned)
+				pruned = append(pruned, prunedFeed{FeedID: row.FeedID, Name: row.FeedName})
+			}
+			if dryRun {
+				pruned[index[row.FeedID]].Posts++
+			}
+		}
+		if dryRun || len(ids) == 0 {
+			return nil
+		}
+
+		// count what was actually deleted, a post may have been starred since
+		deleted, err := q.DeleteUnstarredPosts(ctx, ids)
+		if err != nil {
+			return err
+		}
+		for _, post := range deleted {
+			pruned[index[post.FeedID]].Posts++
+			// remembered so agg doesn't store it again while the feed lists it
+			err := q.RecordPrunedPost(ctx, database.RecordPrunedPostParams{
+				FeedID:   post.FeedID,
+				Guid:     post.Guid,
+				PrunedAt: now,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// drop feeds whose every post turned out to be starred
+	kept := pruned[:0]
+	for _, feed := range pruned {
+		if feed.Posts > 0 {
+			kept = append(kept, feed)
+		}
+	}
+	return kept, nil
+}
+
+func printPruned(pruned []prunedFeed, dryRun bool) {
+	total := 0
+	for _, feed := range pruned {
+		fmt.Printf("* %s: %d posts\n", feed.Name, feed.Posts)
+		total += feed.Posts
+	}
+
+	if dryRun {
+		fmt.Printf("Would prune %d posts from %d feeds\n", total, len(pruned))
+	} else {
+		fmt.Printf("Pruned %d posts from %d feeds\n", total, len(pruned))
+	}
+}
+
+// pruneAfterAgg ends an agg cycle with a prune when the config asks for one
+func pruneAfterAgg(ctx context.Context, s *state) error {
+	if !s.Config.Retention.AfterAgg {
+		return nil
+	}
+
+	pruned, err := prunePosts(ctx, s, time.Now(), false)
+	if err != nil {
+		return err
+	}
+	if len(pruned) > 0 {
+		printPruned(pruned, false)
+	}
+	return nil
+}
+
+// feedRetention returns the limits that apply to feed, falling back to the
+// config file where the feed has none of its own
+func feedRetention(s *state, feed database.Feed) (maxAgeDays, maxPosts int32) {
+	maxAgeDays, maxPosts = s.Config.Retention.MaxAgeDays, s.Config.Retention.MaxPosts
+	if feed.RetentionMaxAgeDays.Valid {
+		maxAgeDays = feed.RetentionMaxAgeDays.Int32
+	}
+	if feed.RetentionMaxPosts.Valid {
+		maxPosts = feed.RetentionMaxPosts.Int32
+	}
+	return maxAgeDays, maxPosts
+}
+
+// retentionCutoff returns the publication time before which items of feed
+// aren't stored, as prune would delete them straight away whether or not
+// anyone has read them. It is zero when the feed keeps posts of any age.
+// Items beyond max posts are stored: prune keeps them until they are read,
+// and records the ones it deletes so they aren't stored again.
+func retentionCutoff(s *state, feed database.Feed, now time.Time) time.Time {
+	maxAgeDays, _ := feedRetention(s, feed)
+	if maxAgeDays <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-time.Duration(maxAgeDays) * 24 * time.Hour)
+}
+
+func retentionHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "retention"
+	if cmd.Command != "retention" {
+		return fmt.Errorf("invalid command")
+	}
+
+	maxAge, args, err := popFlagValue(cmd.Args, "--max-age-days")
+	if err != nil {
+		return err
+	}
+	maxPosts, args, err := popFlagValue(args, "--max-posts")
+	if err != nil {
+		return err
+	}
+
+	// without a feed, list the retention of every feed
+	if len(args) < 1 {
+		if maxAge != "" || maxPosts != "" {
+			return fmt.Errorf("missing feed url argument")
+		}
+
+		fmt.Printf("Default: %s\n", describeRetention(
+			sql.NullInt32{Int32: s.Config.Retention.MaxAgeDays, Valid: true},
+			sql.NullInt32{Int32: s.Config.Retention.MaxPosts, Valid: true},
+			s,
+		))
+		feeds, err := s.db.GetFeeds(context.Background())
+		if err != nil {
+			return err
+		}
+		for _, feed := range feeds {
+			fmt.Printf("* %s: %s\n", feed.Name, describeRetention(feed.RetentionMaxAgeDays, feed.RetentionMaxPosts, s))
+		}
+		return nil
+	}
+
+	feed, err := s.db.GetFeed(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+
+	if maxAge != "" || maxPosts != "" {
+		// posts are shared by every follower, so only whoever added the feed decides
+		if feed.UserID != user.ID {
+			return fmt.Errorf("only the user who added %s can change its retention", feed.Name)
+		}
+
+		params := database.SetFeedRetentionParams{
+			ID:                  feed.ID,
+			RetentionMaxAgeDays: feed.RetentionMaxAgeDays,
+			RetentionMaxPosts:   feed.RetentionMaxPosts,
+			UpdatedAt:           time.Now(),
+		}
+		if maxAge != "" {
+			if params.RetentionMaxAgeDays, err = parseRetentionLimit(maxAge); err != nil {
+				return err
+			}
+		}
+		if maxPosts != "" {
+			if params.RetentionMaxPosts, err = parseRetentionLimit(maxPosts); err != nil {
+				return err
+			}
+		}
+		if err := s.db.SetFeedRetention(context.Background(), params); err != nil {
+			return err
+		}
+		feed.RetentionMaxAgeDays, feed.RetentionMaxPosts = params.RetentionMaxAgeDays, params.RetentionMaxPosts
+	}
+
+	fmt.Printf("%s: %s\n", feed.Name, describeRetention(feed.RetentionMaxAgeDays, feed.RetentionMaxPosts, s))
+
+	return nil
+}
+
+// parseRetentionLimit accepts a number, where 0 is no limit, or "default" to
+// fall back to the config file
+func parseRetentionLimit(value string) (sql.NullInt32, error) {
+	if value == "default" {
+		return sql.NullInt32{}, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || n < 0 {
+		return sql.NullInt32{}, fmt.Errorf("invalid retention limit %s, expected a number or default", value)
+	}
+	return sql.NullInt32{Int32: int32(n), Valid: true}, nil
+}
+
+// describeRetention spells out the limits a feed ends up with, noting those
+// that come from the config file
+func describeRetention(maxAgeDays, maxPosts sql.NullInt32, s *state) string {
+	describe := func(limit sql.NullInt32, fallback int32, format string) string {
+		n := limit.Int32
+		if !limit.Valid {
+			n = fallback
+		}
+		text := "unlimited"
+		if n > 0 {
+			text = fmt.Sprintf(format, n)
+		}
+		if !limit.Valid {
+			text += " (default)"
+		}
+		return text
+	}
+
+	return fmt.Sprintf("max age %s, max posts %s",
+		describe(maxAgeDays, s.Config.Retention.MaxAgeDays, "%d days"),
+		describe(maxPosts, s.Config.Retention.MaxPosts, "%d"))
+}
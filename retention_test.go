@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"internal/config"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+// newSQLiteState is newTestState on a migrated SQLite file, for queries whose
+// SQL differs enough between the backends to be worth running for real
+func newSQLiteState(t *testing.T) *state {
+	t.Helper()
+	s := newTestState(t)
+	conn, store, dialect, err := openStore("sqlite:" + filepath.Join(t.TempDir(), "gator.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s.conn, s.db, s.dialect = conn, store, dialect
+
+	provider, err := newMigrationProvider(conn, dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// postTitles lists the titles of the user's posts, newest first
+func postTitles(t *testing.T, s *state, user database.User) []string {
+	t.Helper()
+	posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{UserID: user.ID, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, post := range posts {
+		titles = append(titles, post.Title)
+	}
+	return titles
+}
+
+func TestPrune(t *testing.T) {
+	t.Run("memdb", func(t *testing.T) { testPrune(t, newTestState(t)) })
+	t.Run("sqlite", func(t *testing.T) { testPrune(t, newSQLiteState(t)) })
+}
+
+func testPrune(t *testing.T, s *state) {
+	alice := registerUser(t, s, "alice")
+	example := newFeedServer(t, "Example",
+		testItem(1, "One", "1"), testItem(2, "Two", "2"), testItem(3, "Three", "3"),
+		testItem(4, "Four", "4"), testItem(5, "Five", "5"),
+	)
+	other := newFeedServer(t, "Other", testItem(6, "Six", "6"), testItem(7, "Seven", "7"), testItem(8, "Eight", "8"))
+	addFeed(t, s, "Example", example)
+	addFeed(t, s, "Other", other)
+	mustRun(t, s, "retention", other.URL, "--max-posts", "0")
+
+	s.Config.Retention.MaxPosts = 2
+
+	// nothing goes while alice hasn't read it
+	if out := mustRun(t, s, "prune"); !strings.Contains(out, "No posts to prune") {
+		t.Errorf("unread posts were pruned:\n%s", out)
+	}
+
+	mustRun(t, s, "mark-all-read")
+	ids := postIDs(t, s, alice)
+	mustRun(t, s, "star", ids[len(ids)-1])
+
+	out := mustRun(t, s, "prune", "--dry-run")
+	if !strings.Contains(out, "* Example: 2 posts\n") || !strings.Contains(out, "Would prune 2 posts from 1 feeds") {
+		t.Errorf("unexpected dry run output:\n%s", out)
+	}
+	if got := len(postIDs(t, s, alice)); got != 8 {
+		t.Fatalf("dry run deleted posts, %d left", got)
+	}
+
+	// Other keeps everything, and the starred post stays past the limit
+	out = mustRun(t, s, "prune")
+	if !strings.Contains(out, "* Example: 2 posts\n") || !strings.Contains(out, "Pruned 2 posts from 1 feeds") {
+		t.Errorf("unexpected prune output:\n%s", out)
+	}
+	want := []string{"Eight", "Seven", "Six", "Five", "Four", "One"}
+	if got := postTitles(t, s, alice); !slices.Equal(got, want) {
+		t.Errorf("left %v, want %v", got, want)
+	}
+
+	// past the max age posts go even if someone hasn't read them
+	bob := registerUser(t, s, "bob")
+	mustRun(t, s, "follow", other.URL)
+	s.Config.Retention.MaxAgeDays = 3
+
+	pruned, err := prunePosts(context.Background(), s, time.Date(2024, 1, 11, 12, 0, 0, 0, time.UTC), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 2 || pruned[0].Name != "Example" || pruned[0].Posts != 2 || pruned[1].Name != "Other" || pruned[1].Posts != 1 {
+		t.Errorf("unexpected pruned feeds: %+v", pruned)
+	}
+	want = []string{"Eight", "Seven", "One"}
+	if got := postTitles(t, s, alice); !slices.Equal(got, want) {
+		t.Errorf("left %v, want %v", got, want)
+	}
+	if got := postTitles(t, s, bob); !slices.Equal(got, []string{"Eight", "Seven"}) {
+		t.Errorf("bob sees %v", got)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	s := newTestState(t)
+	registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"))
+	feed := addFeed(t, s, "Example", fs)
+	s.Config.Retention.MaxPosts = 500
+
+	out := mustRun(t, s, "retention")
+	if !strings.Contains(out, "Default: max age unlimited, max posts 500\n") ||
+		!strings.Contains(out, "* Example: max age unlimited (default), max posts 500 (default)\n") {
+		t.Errorf("unexpected retention output:\n%s", out)
+	}
+
+	out = mustRun(t, s, "retention", feed.Url, "--max-age-days", "30")
+	if !strings.Contains(out, "Example: max age 30 days, max posts 500 (default)\n") {
+		t.Errorf("unexpected retention output:\n%s", out)
+	}
+	out = mustRun(t, s, "retention", "--max-posts", "0", feed.Url)
+	if !strings.Contains(out, "Example: max age 30 days, max posts unlimited\n") {
+		t.Errorf("unexpected retention output:\n%s", out)
+	}
+	out = mustRun(t, s, "retention", feed.Url, "--max-age-days", "default")
+	if !strings.Contains(out, "Example: max age unlimited (default), max posts unlimited\n") {
+		t.Errorf("unexpected retention output:\n%s", out)
+	}
+
+	for _, args := range [][]string{
+		{feed.Url, "--max-posts", "-1"},
+		{feed.Url, "--max-age-days", "forever"},
+		{feed.Url, "--max-posts"},
+		{"--max-posts", "10"},
+		{"https://example.com/unknown.xml"},
+	} {
+		if _, err := run(t, s, "retention", args...); err == nil {
+			t.Errorf("retention %v: expected an error", args)
+		}
+	}
+
+	// only the user who added the feed sets its retention
+	registerUser(t, s, "bob")
+	if _, err := run(t, s, "retention", feed.Url, "--max-posts", "1"); err == nil {
+		t.Error("bob changed the retention of alice's feed")
+	}
+	if out := mustRun(t, s, "retention", feed.Url); !strings.Contains(out, "max posts unlimited\n") {
+		t.Errorf("unexpected retention output:\n%s", out)
+	}
+}
+
+func TestAggPrunes(t *testing.T) {
+	t.Run("memdb", func(t *testing.T) { testAggPrunes(t, newTestState(t)) })
+	t.Run("sqlite", func(t *testing.T) { testAggPrunes(t, newSQLiteState(t)) })
+}
+
+func testAggPrunes(t *testing.T, s *state) {
+	alice := registerUser(t, s, "alice")
+	s.Config.Retention = config.Retention{MaxPosts: 2, AfterAgg: true}
+
+	// items beyond the limit are stored, and kept until they have been read
+	fs := newFeedServer(t, "Example", testItem(1, "One", "1"), testItem(2, "Two", "2"), testItem(3, "Three", "3"))
+	addFeed(t, s, "Example", fs)
+	if got := postTitles(t, s, alice); !slices.Equal(got, []string{"Three", "Two", "One"}) {
+		t.Fatalf("stored %v", got)
+	}
+
+	mustRun(t, s, "mark-all-read")
+	fs.setItems(testItem(1, "One", "1"), testItem(2, "Two", "2"), testItem(3, "Three", "3"), testItem(4, "Four", "4"))
+	out := mustRun(t, s, "agg", "--once")
+	if !strings.Contains(out, "Post created: Four") || !strings.Contains(out, "Pruned 2 posts from 1 feeds") {
+		t.Errorf("unexpected agg output:\n%s", out)
+	}
+	if got := postTitles(t, s, alice); !slices.Equal(got, []string{"Four", "Three"}) {
+		t.Errorf("left %v", got)
+	}
+
+	// the feed still lists what was pruned, which isn't stored again
+	out = mustRun(t, s, "agg", "--once")
+	if strings.Contains(out, "Post created") || strings.Contains(out, "Pruned") {
+		t.Errorf("a pruned post came back:\n%s", out)
+	}
+
+	// items past the max age are never stored, read or not
+	s.Config.Retention = config.Retention{MaxAgeDays: 3}
+	fs.setItems(testItem(5, "Five", "5"))
+	if out := mustRun(t, s, "agg", "--once"); strings.Contains(out, "Post created") {
+		t.Errorf("an expired item was stored:\n%s", out)
+	}
+}
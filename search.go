@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+const searchResultLimit = 20
+
+func searchHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "search"
+	if cmd.Command != "search" {
+		return fmt.Errorf("invalid command")
+	}
+
+	// Check if the arguments are valid
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("missing query argument")
+	}
+
+	query := searchQuery(cmd.Args)
+
+	posts, err := s.db.SearchPostsForUser(context.Background(), database.SearchPostsForUserParams{
+		Query:      query,
+		UserID:     user.ID,
+		MaxResults: searchResultLimit,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(posts) == 0 {
+		fmt.Printf("No posts match %s\n", query)
+		return nil
+	}
+
+	for _, post := range posts {
+		fmt.Printf("* %s %s, ", post.ID, post.Title)
+		fmt.Printf("  %s, ", post.Url)
+		fmt.Printf("%s, %s \n", post.FeedName, post.PublishedAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// searchQuery rebuilds the query the shell split into args. The shell has
+// already removed the quotes of `search "postgres vacuum" -mysql`, so an arg
+// with spaces in it was a phrase and is quoted again. Args that still hold
+// quotes, like '"postgres vacuum" -mysql', are used as typed.
+func searchQuery(args []string) string {
+	terms := make([]string, 0, len(args))
+	for _, arg := range args {
+		if strings.ContainsAny(arg, " \t\r\n") && !strings.Contains(arg, `"`) {
+			// keep the exclusion of -"foo bar" outside the phrase
+			exclude := ""
+			if strings.HasPrefix(arg, "-") {
+				exclude, arg = "-", arg[1:]
+			}
+			arg = exclude + `"` + arg + `"`
+		}
+		terms = append(terms, arg)
+	}
+	return strings.Join(terms, " ")
+}
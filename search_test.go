@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	s := newTestState(t)
+	registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example",
+		testItem(1, "Tuning postgres", "vacuum and indexes"),
+		testItem(2, "Postgres vs mysql", "a vacuum comparison"),
+		testItem(3, "Gardening", "tomatoes"),
+	)
+	addFeed(t, s, "Example", fs)
+
+	out := mustRun(t, s, "search", "vacuum")
+	if strings.Count(out, "* ") != 2 || strings.Contains(out, "Gardening") {
+		t.Errorf("unexpected results:\n%s", out)
+	}
+
+	// the shell passes `search "postgres vs" -tomatoes` without the quotes
+	out = mustRun(t, s, "search", "postgres vs", "-tomatoes")
+	if strings.Count(out, "* ") != 1 || !strings.Contains(out, "Postgres vs mysql") {
+		t.Errorf("unexpected phrase results:\n%s", out)
+	}
+	// a phrase is not just its words: "vacuum postgres" doesn't appear in that order
+	out = mustRun(t, s, "search", "vacuum postgres")
+	if !strings.Contains(out, "No posts match") {
+		t.Errorf("unexpected phrase results:\n%s", out)
+	}
+	// single quotes keep the double quotes, and the whole query can be one arg
+	out = mustRun(t, s, "search", `"postgres vs" -tomatoes`)
+	if strings.Count(out, "* ") != 1 || !strings.Contains(out, "Postgres vs mysql") {
+		t.Errorf("unexpected quoted query results:\n%s", out)
+	}
+	out = mustRun(t, s, "search", "vacuum", "-a vacuum")
+	if strings.Count(out, "* ") != 1 || !strings.Contains(out, "Tuning postgres") {
+		t.Errorf("unexpected excluded phrase results:\n%s", out)
+	}
+
+	out = mustRun(t, s, "search", "vacuum", "-mysql")
+	if strings.Count(out, "* ") != 1 || !strings.Contains(out, "Tuning postgres") {
+		t.Errorf("unexpected exclusion results:\n%s", out)
+	}
+
+	out = mustRun(t, s, "search", "tomatoes", "or", "indexes")
+	if strings.Count(out, "* ") != 2 || !strings.Contains(out, "Gardening") || !strings.Contains(out, "Tuning postgres") {
+		t.Errorf("unexpected or results:\n%s", out)
+	}
+
+	out = mustRun(t, s, "search", "kubernetes")
+	if !strings.Contains(out, "No posts match kubernetes") {
+		t.Errorf("unexpected output for no results:\n%s", out)
+	}
+
+	// posts of feeds the user doesn't follow are not searched
+	registerUser(t, s, "bob")
+	out = mustRun(t, s, "search", "vacuum")
+	if strings.Contains(out, "* ") {
+		t.Errorf("bob found posts of feeds they don't follow:\n%s", out)
+	}
+
+	if _, err := run(t, s, "search"); err == nil {
+		t.Error("expected an error without a query")
+	}
+}
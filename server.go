@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jsleep/blog_aggregator/internal/database"
+	"github.com/pressly/goose/v3"
+)
+
+const (
+	defaultServeAddr = ":8080"
+	defaultPageSize  = 20
+	maxPageSize      = 100
+)
+
+type apiHandler func(s *state, w http.ResponseWriter, r *http.Request)
+
+type authedAPIHandler func(s *state, w http.ResponseWriter, r *http.Request, user database.User)
+
+func serveHandler(s *state, cmd command) error {
+	// Check if the command is "serve"
+	if cmd.Command != "serve" {
+		return fmt.Errorf("invalid command")
+	}
+
+	// --agg runs agg inside serve, so its streams work without Postgres
+	aggEvery, args, err := popFlagValue(cmd.Args, "--agg")
+	if err != nil {
+		return err
+	}
+	var aggInterval time.Duration
+	if aggEvery != "" {
+		aggInterval, err = time.ParseDuration(aggEvery)
+		if err != nil || aggInterval <= 0 {
+			return fmt.Errorf("invalid duration: %s", aggEvery)
+		}
+	}
+
+	addr := defaultServeAddr
+	if len(args) >= 1 {
+		addr = args[0]
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           newRouter(s),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// open streams would otherwise hold up Shutdown until its timeout
+	srv.RegisterOnShutdown(s.hub.close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// posts ingested by a separate agg process arrive through NOTIFY, which
+	// only postgres has
+	if s.dialect == goose.DialectPostgres {
+		if err := listenForPosts(ctx, s); err != nil {
+			fmt.Printf("Not listening for posts from other processes: %v\n", err)
+		}
+	}
+
+	if aggInterval > 0 {
+		aggCtx, cancelAgg := context.WithCancel(ctx)
+		aggDone := make(chan struct{})
+		s.aggregating = true
+		go func() {
+			defer close(aggDone)
+			aggregate(aggCtx, s, aggInterval, 1)
+		}()
+		// like agg, finish writing the feeds in flight and the webhook
+		// deliveries before exiting
+		defer func() {
+			cancelAgg()
+			<-aggDone
+			s.webhooks.wait()
+		}()
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	fmt.Printf("Serving on %s\n", addr)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+func newRouter(s *state) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /v1/healthz", func(w http.ResponseWriter, r *http.Request) {
+		respondWithJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	mux.HandleFunc("GET /v1/users", route(s, apiListUsers))
+	mux.HandleFunc("POST /v1/users", route(s, apiCreateUser))
+	mux.HandleFunc("GET /v1/users/me", route(s, middlewareAPIUser(apiGetCurrentUser)))
+
+	mux.HandleFunc("GET /v1/feeds", route(s, apiListFeeds))
+	mux.HandleFunc("POST /v1/feeds", route(s, middlewareAPIUser(apiCreateFeed)))
+
+	mux.HandleFunc("GET /v1/feed_follows", route(s, middlewareAPIUser(apiListFeedFollows)))
+	mux.HandleFunc("POST /v1/feed_follows", route(s, middlewareAPIUser(apiCreateFeedFollow)))
+	mux.HandleFunc("DELETE /v1/feed_follows/{feedID}", route(s, middlewareAPIUser(apiDeleteFeedFollow)))
+
+	mux.HandleFunc("GET /v1/posts", route(s, middlewareAPIUser(apiListPosts)))
+	mux.HandleFunc("GET /v1/posts/stream", route(s, middlewareAPIUser(apiStreamPosts)))
+	mux.HandleFunc("GET /v1/timeline", route(s, middlewareFeedReader(apiTimeline)))
+
+	// Fever authenticates with its own key in the request body
+	mux.HandleFunc("/fever/", route(s, apiFever))
+
+	return mux
+}
+
+func route(s *state, handler apiHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(s, w, r)
+	}
+}
+
+// middlewareAPIUser is the HTTP counterpart of middlewareLoggedIn: it resolves
+// the user from an "Authorization: ApiKey <key>" (or Bearer) header
+func middlewareAPIUser(handler authedAPIHandler) apiHandler {
+	return func(s *state, w http.ResponseWriter, r *http.Request) {
+		key, err := getAPIKey(r)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		user, err := s.db.GetUserByAPIKey(r.Context(), nullString(hashToken(key)))
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusUnauthorized, "invalid api key")
+			return
+		}
+		if err != nil {
+			respondWithDBError(w, err)
+			return
+		}
+
+		handler(s, w, r, user)
+	}
+}
+
+// middlewareFeedReader is middlewareAPIUser for feeds readers subscribe to by
+// URL: they can't send headers, so the key may also come as ?api_key=. Only
+// read-only routes should use it, since the key ends up in reader and proxy logs
+func middlewareFeedReader(handler authedAPIHandler) apiHandler {
+	authed := middlewareAPIUser(handler)
+	return func(s *state, w http.ResponseWriter, r *http.Request) {
+		if key := r.URL.Query().Get("api_key"); key != "" && r.Header.Get("Authorization") == "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "ApiKey "+key)
+		}
+		authed(s, w, r)
+	}
+}
+
+func getAPIKey(r *http.Request) (string, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return "", errors.New("missing authorization header")
+	}
+
+	scheme, key, ok := strings.Cut(auth, " ")
+	if !ok || (scheme != "ApiKey" && scheme != "Bearer") || strings.TrimSpace(key) == "" {
+		return "", errors.New("malformed authorization header")
+	}
+
+	return strings.TrimSpace(key), nil
+}
+
+func apiListUsers(s *state, w http.ResponseWriter, r *http.Request) {
+	users, err := s.db.GetUsers(r.Context())
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	resp := make([]User, 0, len(users))
+	for _, user := range users {
+		resp = append(resp, databaseUserToUser(user))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func apiCreateUser(s *state, w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if params.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	apiKey, apiKeyHash, err := generateToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not generate api key")
+		return
+	}
+
+	user, err := s.db.CreateUser(r.Context(), database.CreateUserParams{
+		ID:         uuid.New(),
+		Name:       params.Name,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+		ApiKeyHash: nullString(apiKeyHash),
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	resp := databaseUserToUser(user)
+	resp.APIKey = apiKey
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+func apiGetCurrentUser(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	respondWithJSON(w, http.StatusOK, databaseUserToUser(user))
+}
+
+func apiListFeeds(s *state, w http.ResponseWriter, r *http.Request) {
+	feeds, err := s.db.GetFeeds(r.Context())
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	resp := make([]Feed, 0, len(feeds))
+	for _, feed := range feeds {
+		resp = append(resp, databaseFeedToFeed(feed))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func apiCreateFeed(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	var params struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if params.Name == "" || params.URL == "" {
+		respondWithError(w, http.StatusBadRequest, "name and url are required")
+		return
+	}
+
+	var feed database.Feed
+	err := s.db.InTx(r.Context(), func(q database.Querier) error {
+		var err error
+		feed, err = q.CreateFeed(r.Context(), database.CreateFeedParams{
+			ID:        uuid.New(),
+			Name:      params.Name,
+			Url:       params.URL,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			UserID:    user.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		// like addfeed, the creator follows the feed they just added
+		_, err = q.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			FeedID:    feed.ID,
+			CreatedAt: time.Now(),
+		})
+		return err
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, databaseFeedToFeed(feed))
+}
+
+func apiListFeedFollows(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	follows, err := s.db.GetFeedFollowsForUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	resp := make([]FeedFollow, 0, len(follows))
+	for _, follow := range follows {
+		resp = append(resp, databaseFeedFollowToFeedFollow(follow))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func apiCreateFeedFollow(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	var params struct {
+		FeedID   uuid.UUID `json:"feed_id"`
+		Category string    `json:"category"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	feed, err := s.db.GetFeedById(r.Context(), params.FeedID)
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	follow, err := s.db.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+		CreatedAt: time.Now(),
+		Category:  params.Category,
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, FeedFollow{
+		ID:        follow.ID,
+		FeedID:    follow.FeedID,
+		FeedName:  follow.FeedName,
+		UserID:    follow.UserID,
+		Category:  follow.Category,
+		CreatedAt: follow.CreatedAt,
+	})
+}
+
+func apiDeleteFeedFollow(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	feedID, err := uuid.Parse(r.PathValue("feedID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid feed id")
+		return
+	}
+
+	err = s.db.RemoveFeedFollow(r.Context(), database.RemoveFeedFollowParams{
+		UserID: user.ID,
+		FeedID: feedID,
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiListPosts(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	limit, offset, err := pagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	posts, err := s.db.GetPostsForUser(r.Context(), database.GetPostsForUserParams{
+		UserID: user.ID,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondWithDBError(w, err)
+		return
+	}
+
+	resp := make([]Post, 0, len(posts))
+	for _, post := range posts {
+		resp = append(resp, databasePostToPost(post))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// pagination reads ?limit= and ?offset=, defaulting to the first page
+func pagination(r *http.Request) (int32, int32, error) {
+	limit, offset := defaultPageSize, 0
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		limit = n
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+		offset = n
+	}
+
+	return int32(limit), int32(offset), nil
+}
+
+func respondWithJSON(w http.ResponseWriter, code int, payload any) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshalling JSON: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+func respondWithError(w http.ResponseWriter, code int, msg string) {
+	respondWithJSON(w, code, map[string]string{"error": msg})
+}
+
+// respondWithDBError maps database errors onto HTTP status codes
+func respondWithDBError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		respondWithError(w, http.StatusNotFound, "not found")
+	case isUniqueViolation(err):
+		respondWithError(w, http.StatusConflict, "already exists")
+	default:
+		log.Printf("Database error: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
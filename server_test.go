@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestServe(t *testing.T) {
+	s := newTestState(t)
+
+	// find a free port for the server to listen on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := run(t, s, "serve", addr)
+		errc <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get("http://" + addr + "/v1/healthz")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("healthz: status %d", resp.StatusCode)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server never came up: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// serve shuts down cleanly on ctrl-c
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("serve returned %v", err)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("serve didn't stop on SIGINT")
+	}
+}
+
+func TestAPI(t *testing.T) {
+	s := newTestState(t)
+	srv := httptest.NewServer(newRouter(s))
+	defer srv.Close()
+
+	var alice User
+	if code := apiRequest(t, srv, "POST", "/v1/users", "", `{"name": "alice"}`, &alice); code != http.StatusCreated || alice.APIKey == "" {
+		t.Fatalf("create user: status %d, %+v", code, alice)
+	}
+	var bob User
+	apiRequest(t, srv, "POST", "/v1/users", "", `{"name": "bob"}`, &bob)
+
+	for _, tt := range []struct {
+		method, path, key, body string
+		want                    int
+	}{
+		{"POST", "/v1/users", "", `{"name": "alice"}`, http.StatusConflict},
+		{"POST", "/v1/users", "", `{"name": ""}`, http.StatusBadRequest},
+		{"POST", "/v1/users", "", `not json`, http.StatusBadRequest},
+		{"GET", "/v1/users/me", "", "", http.StatusUnauthorized},
+		{"GET", "/v1/users/me", "wrong", "", http.StatusUnauthorized},
+		{"GET", "/v1/users/me?api_key=" + alice.APIKey, "", "", http.StatusUnauthorized},
+		{"POST", "/v1/feeds?api_key=" + alice.APIKey, "", `{"name": "Example"}`, http.StatusUnauthorized},
+		{"POST", "/v1/feeds", alice.APIKey, `{"name": "Example"}`, http.StatusBadRequest},
+		{"POST", "/v1/feed_follows", bob.APIKey, `{"feed_id": "` + uuid.NewString() + `"}`, http.StatusNotFound},
+		{"POST", "/v1/feed_follows", bob.APIKey, `{"feed_id": "nope"}`, http.StatusBadRequest},
+		{"DELETE", "/v1/feed_follows/nope", bob.APIKey, "", http.StatusBadRequest},
+		{"GET", "/v1/posts?limit=0", alice.APIKey, "", http.StatusBadRequest},
+		{"GET", "/v1/posts?limit=101", alice.APIKey, "", http.StatusBadRequest},
+		{"GET", "/v1/posts?offset=-1", alice.APIKey, "", http.StatusBadRequest},
+	} {
+		if code := apiRequest(t, srv, tt.method, tt.path, tt.key, tt.body, nil); code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, code, tt.want)
+		}
+	}
+
+	// both schemes of the Authorization header are accepted
+	for scheme, want := range map[string]int{"ApiKey": http.StatusOK, "Bearer": http.StatusOK, "Basic": http.StatusUnauthorized} {
+		r, _ := http.NewRequest("GET", srv.URL+"/v1/users/me", nil)
+		r.Header.Set("Authorization", scheme+" "+alice.APIKey)
+		resp, err := srv.Client().Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("Authorization: %s: status %d, want %d", scheme, resp.StatusCode, want)
+		}
+	}
+
+	var me User
+	if code := apiRequest(t, srv, "GET", "/v1/users/me", alice.APIKey, "", &me); code != http.StatusOK || me.ID != alice.ID || me.APIKey != "" {
+		t.Errorf("me: status %d, %+v", code, me)
+	}
+	var users []User
+	if apiRequest(t, srv, "GET", "/v1/users", "", "", &users); len(users) != 2 {
+		t.Errorf("users: %+v", users)
+	}
+
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"), testItem(2, "Two", "second"))
+	var feed Feed
+	code := apiRequest(t, srv, "POST", "/v1/feeds", alice.APIKey, `{"name": "Example", "url": "`+fs.URL+`"}`, &feed)
+	if code != http.StatusCreated || feed.UserID != alice.ID || feed.LastFetchedAt != nil {
+		t.Fatalf("create feed: status %d, %+v", code, feed)
+	}
+	if code := apiRequest(t, srv, "POST", "/v1/feeds", bob.APIKey, `{"name": "Other", "url": "`+fs.URL+`"}`, nil); code != http.StatusConflict {
+		t.Errorf("duplicate feed url: status %d", code)
+	}
+	var feeds []Feed
+	if apiRequest(t, srv, "GET", "/v1/feeds", "", "", &feeds); len(feeds) != 1 || feeds[0].ID != feed.ID {
+		t.Errorf("feeds: %+v", feeds)
+	}
+
+	// the creator follows the feed; bob follows it into a category
+	var follows []FeedFollow
+	if apiRequest(t, srv, "GET", "/v1/feed_follows", alice.APIKey, "", &follows); len(follows) != 1 || follows[0].FeedID != feed.ID {
+		t.Errorf("alice's follows: %+v", follows)
+	}
+	var follow FeedFollow
+	body := `{"feed_id": "` + feed.ID.String() + `", "category": "Tech"}`
+	if code := apiRequest(t, srv, "POST", "/v1/feed_follows", bob.APIKey, body, &follow); code != http.StatusCreated || follow.Category != "Tech" || follow.FeedName != "Example" {
+		t.Errorf("follow: status %d, %+v", code, follow)
+	}
+	if code := apiRequest(t, srv, "POST", "/v1/feed_follows", bob.APIKey, body, nil); code != http.StatusConflict {
+		t.Errorf("following twice: status %d", code)
+	}
+
+	mustRun(t, s, "agg", "--once")
+	var posts []Post
+	if code := apiRequest(t, srv, "GET", "/v1/posts", bob.APIKey, "", &posts); code != http.StatusOK || len(posts) != 2 || posts[0].Title != "Two" {
+		t.Fatalf("posts: status %d, %+v", code, posts)
+	}
+	if apiRequest(t, srv, "GET", "/v1/posts?limit=1&offset=1", bob.APIKey, "", &posts); len(posts) != 1 || posts[0].Title != "One" {
+		t.Errorf("second page: %+v", posts)
+	}
+
+	if code := apiRequest(t, srv, "DELETE", "/v1/feed_follows/"+feed.ID.String(), bob.APIKey, "", nil); code != http.StatusNoContent {
+		t.Errorf("unfollow: status %d", code)
+	}
+	if apiRequest(t, srv, "GET", "/v1/posts", bob.APIKey, "", &posts); len(posts) != 0 {
+		t.Errorf("posts after unfollowing: %+v", posts)
+	}
+}
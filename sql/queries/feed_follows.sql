@@ -1,11 +1,12 @@
 -- name: CreateFeedFollow :one
 WITH inserted_feed_follow AS (
-    INSERT INTO feed_follows (id, created_at, user_id, feed_id)
+    INSERT INTO feed_follows (id, created_at, user_id, feed_id, category)
     VALUES (
         $1,
         $2,
         $3,
-        $4
+        $4,
+        $5
     )
     RETURNING *
 )
@@ -25,10 +26,12 @@ WITH feed_follows AS (
 SELECT
     feed_follows.*,
     feeds.name AS feed_name,
+    feeds.url AS feed_url,
     users.name AS user_name
 FROM feed_follows
 INNER JOIN feeds ON feed_follows.feed_id = feeds.id
-INNER JOIN users ON feed_follows.user_id = users.id;
+INNER JOIN users ON feed_follows.user_id = users.id
+ORDER BY feed_follows.category, feeds.name;
 
 -- name: RemoveFeedFollow :exec
 DELETE FROM feed_follows
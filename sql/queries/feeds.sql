@@ -14,16 +14,54 @@ RETURNING *;
 SELECT * FROM feeds
 WHERE url = $1;
 
+-- name: GetFeedById :one
+SELECT * FROM feeds
+WHERE id = $1;
+
 -- name: GetFeeds :many
 SELECT * FROM feeds;
 
 -- name: MarkFeedFetched :exec
 UPDATE feeds
 SET last_fetched_at = $2,
-    updated_at = $2
+    updated_at = $2,
+    etag = $3,
+    last_modified = $4,
+    error_count = 0,
+    last_error = NULL,
+    last_error_at = NULL
 WHERE id = $1;
 
--- name: GetNextFeedToFetch :one
-SELECT * FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1;
\ No newline at end of file
+-- name: MarkFeedFailed :exec
+UPDATE feeds
+SET last_fetched_at = $2,
+    error_count = error_count + 1,
+    last_error = $3,
+    last_error_at = $2
+WHERE id = $1;
+
+-- name: GetNextFeedsToFetch :many
+-- claims a batch of stale feeds by stamping last_fetched_at, skipping rows
+-- another worker has locked so no feed is fetched twice. Failing feeds back
+-- off exponentially: 1m, 2m, 4m, ... capped at ~17h.
+UPDATE feeds
+SET last_fetched_at = $1
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE (last_fetched_at IS NULL OR last_fetched_at < $1)
+    AND (
+        error_count = 0
+        OR last_error_at + INTERVAL '1 minute' * (1 << LEAST(error_count - 1, 10)) < $1
+    )
+    ORDER BY last_fetched_at ASC NULLS FIRST
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: SetFeedRetention :exec
+UPDATE feeds
+SET retention_max_age_days = $2,
+    retention_max_posts = $3,
+    updated_at = $4
+WHERE id = $1;
@@ -0,0 +1,72 @@
+-- name: GetUserByFeverKey :one
+SELECT * FROM users
+WHERE fever_api_key = $1;
+
+-- name: SetUserFeverKey :exec
+UPDATE users
+SET fever_api_key = $2,
+    updated_at = $3
+WHERE id = $1;
+
+-- name: GetFeverFeedsForUser :many
+SELECT
+    feeds.fever_id,
+    feeds.name,
+    feeds.url,
+    feeds.last_fetched_at,
+    feed_follows.category
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = $1
+ORDER BY feeds.name;
+
+-- name: GetFeverItemsForUser :many
+-- pages forward from since_id, or backward from max_id when it is given
+SELECT
+    posts.id,
+    posts.fever_id,
+    feeds.fever_id AS feed_fever_id,
+    posts.title,
+    posts.url,
+    posts.description,
+    posts.published_at,
+    COALESCE(post_states.read, FALSE)::BOOLEAN AS is_read,
+    COALESCE(post_states.starred, FALSE)::BOOLEAN AS is_saved
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = @user_id
+AND (sqlc.narg(since_id)::BIGINT IS NULL OR posts.fever_id > sqlc.narg(since_id))
+AND (sqlc.narg(max_id)::BIGINT IS NULL OR posts.fever_id < sqlc.narg(max_id))
+AND (COALESCE(CARDINALITY(@with_ids::BIGINT[]), 0) = 0 OR posts.fever_id = ANY(@with_ids::BIGINT[]))
+ORDER BY
+    CASE WHEN sqlc.narg(max_id)::BIGINT IS NULL THEN posts.fever_id END ASC,
+    posts.fever_id DESC
+LIMIT @max_items;
+
+-- name: CountPostsForUser :one
+SELECT COUNT(*) FROM feed_follows
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = $1;
+
+-- name: GetUnreadFeverIDsForUser :many
+SELECT posts.fever_id FROM feed_follows
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1 AND post_states.read IS NOT TRUE
+ORDER BY posts.fever_id;
+
+-- name: GetSavedFeverIDsForUser :many
+SELECT posts.fever_id FROM post_states
+INNER JOIN posts ON post_states.post_id = posts.id
+WHERE post_states.user_id = $1 AND post_states.starred
+ORDER BY posts.fever_id;
+
+-- name: GetPostByFeverID :one
+SELECT * FROM posts
+WHERE fever_id = $1;
+
+-- name: GetFeedByFeverID :one
+SELECT * FROM feeds
+WHERE fever_id = $1;
@@ -1,5 +1,7 @@
 -- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, published_at, url, feed_id, title, description)
+-- inserts a new post, or updates it in place when the item was edited since
+-- it was last fetched. Unchanged items return no rows.
+INSERT INTO posts (id, created_at, updated_at, published_at, url, feed_id, title, description, guid, content_hash)
 VALUES (
     $1,
     $2,
@@ -8,9 +10,33 @@ VALUES (
     $5,
     $6,
     $7,
-    $8
+    $8,
+    $9,
+    $10
 )
-RETURNING *;
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = excluded.title,
+    url = excluded.url,
+    description = excluded.description,
+    updated_at = excluded.updated_at,
+    content_hash = excluded.content_hash
+WHERE posts.content_hash <> excluded.content_hash
+RETURNING *, (xmax = 0) AS inserted;
+
+-- name: AdoptLegacyPostGUID :exec
+-- posts stored before guids were tracked have their url as a placeholder guid
+-- and no content hash. The first fetch that sees the item's real guid moves
+-- the post onto it, so CreatePost updates it instead of storing a copy.
+UPDATE posts
+SET guid = sqlc.arg(guid)
+WHERE posts.feed_id = sqlc.arg(feed_id)
+    AND posts.guid = sqlc.arg(url)
+    AND posts.url = sqlc.arg(url)
+    AND posts.content_hash = ''
+    AND NOT EXISTS (
+        SELECT 1 FROM posts AS adopted
+        WHERE adopted.feed_id = sqlc.arg(feed_id) AND adopted.guid = sqlc.arg(guid)
+    );
 
 -- name: GetPostsForUser :many
 WITH feed_follows AS (
@@ -26,4 +52,137 @@ INNER JOIN feeds ON feed_follows.feed_id = feeds.id
 INNER JOIN users ON feed_follows.user_id = users.id
 INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
 ORDER BY posts.published_at DESC
-LIMIT $2;
\ No newline at end of file
+LIMIT $2 OFFSET $3;
+
+-- name: GetUnreadPostsForUser :many
+WITH feed_follows AS (
+    SELECT * FROM feed_follows
+    WHERE feed_follows.user_id = $1
+)
+SELECT
+    feeds.name AS feed_name,
+    users.name AS user_name,
+    posts.*
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN users ON feed_follows.user_id = users.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE post_states.read IS NOT TRUE
+ORDER BY posts.published_at DESC
+LIMIT $2;
+
+-- name: GetPost :one
+SELECT * FROM posts
+WHERE id = $1;
+
+-- name: GetFollowedPost :one
+-- returns no rows unless the user follows the post's feed
+SELECT posts.*, feeds.name AS feed_name FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE posts.id = $1 AND feed_follows.user_id = $2;
+
+-- name: NotifyNewPost :exec
+SELECT pg_notify('new_posts', sqlc.arg(payload)::text);
+
+-- name: SearchPostsForUser :many
+-- websearch_to_tsquery accepts "quoted phrases", -negation and OR
+SELECT
+    feeds.name AS feed_name,
+    posts.*,
+    ts_rank(posts.search, query)::REAL AS rank
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id,
+    websearch_to_tsquery('english', @query) AS query
+WHERE feed_follows.user_id = @user_id
+AND posts.search @@ query
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT @max_results;
+
+-- name: GetTimelineForUser :many
+-- optionally narrowed to one followed feed, or to a category tag and the
+-- folders nested below it
+SELECT
+    feeds.name AS feed_name,
+    feeds.url AS feed_url,
+    posts.*
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = @user_id
+AND (sqlc.narg(feed_id)::uuid IS NULL OR feed_follows.feed_id = sqlc.narg(feed_id))
+AND (
+    sqlc.narg(category)::text IS NULL
+    OR feed_follows.category = sqlc.narg(category)
+    OR feed_follows.category LIKE sqlc.narg(category) || '/%'
+)
+ORDER BY posts.published_at DESC
+LIMIT @max_posts;
+
+-- name: GetPrunablePosts :many
+-- lists the posts past their feed's retention: older than the max age, or
+-- beyond the newest max posts. A feed's own limits override the defaults and
+-- 0 means no limit. Starred posts are always kept, and so are posts a
+-- follower hasn't read yet until they pass the max age.
+WITH limits AS (
+    SELECT
+        feeds.id AS feed_id,
+        COALESCE(feeds.retention_max_age_days, @default_max_age_days::int) AS max_age_days,
+        COALESCE(feeds.retention_max_posts, @default_max_posts::int) AS max_posts
+    FROM feeds
+), candidates AS (
+    SELECT
+        posts.id,
+        posts.feed_id,
+        limits.max_age_days > 0
+            AND posts.published_at < sqlc.arg(now)::timestamp - INTERVAL '1 day' * limits.max_age_days AS expired,
+        limits.max_posts > 0
+            AND row_number() OVER (PARTITION BY posts.feed_id ORDER BY posts.published_at DESC, posts.id) > limits.max_posts AS over_limit
+    FROM posts
+    INNER JOIN limits ON limits.feed_id = posts.feed_id
+)
+SELECT
+    candidates.id,
+    candidates.feed_id,
+    feeds.name AS feed_name,
+    feeds.url AS feed_url
+FROM candidates
+INNER JOIN feeds ON feeds.id = candidates.feed_id
+WHERE (candidates.expired OR candidates.over_limit)
+AND NOT EXISTS (
+    SELECT 1 FROM post_states
+    WHERE post_states.post_id = candidates.id AND post_states.starred
+)
+AND (
+    candidates.expired
+    OR NOT EXISTS (
+        SELECT 1 FROM feed_follows
+        LEFT JOIN post_states ON post_states.post_id = candidates.id AND post_states.user_id = feed_follows.user_id
+        WHERE feed_follows.feed_id = candidates.feed_id AND post_states.read IS NOT TRUE
+    )
+)
+ORDER BY feeds.name;
+
+-- name: DeleteUnstarredPosts :many
+-- checks for stars again in case one was added since the posts were listed,
+-- and returns the feed and guid of every deleted post
+DELETE FROM posts
+WHERE id = ANY(@ids::uuid[])
+AND NOT EXISTS (
+    SELECT 1 FROM post_states
+    WHERE post_states.post_id = posts.id AND post_states.starred
+)
+RETURNING feed_id, guid;
+
+-- name: RecordPrunedPost :exec
+INSERT INTO pruned_posts (feed_id, guid, pruned_at)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING;
+
+-- name: IsPostPruned :one
+SELECT EXISTS (
+    SELECT 1 FROM pruned_posts
+    WHERE feed_id = $1 AND guid = $2
+);
@@ -0,0 +1,51 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, user_id, feed_id, url, secret)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetWebhooksForUser :many
+SELECT webhooks.*, feeds.url AS feed_url FROM webhooks
+LEFT JOIN feeds ON webhooks.feed_id = feeds.id
+WHERE webhooks.user_id = $1
+ORDER BY webhooks.created_at;
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetWebhooksForFeed :many
+-- webhooks without a feed only fire for feeds their owner follows
+SELECT webhooks.* FROM webhooks
+WHERE webhooks.feed_id = @feed_id::uuid
+OR (
+    webhooks.feed_id IS NULL
+    AND EXISTS (
+        SELECT 1 FROM feed_follows
+        WHERE feed_follows.user_id = webhooks.user_id AND feed_follows.feed_id = @feed_id::uuid
+    )
+);
+
+-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, webhook_id, post_id, attempt, status_code, error, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+);
+
+-- name: GetLastWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE webhook_id = $1
+ORDER BY created_at DESC
+LIMIT 1;
@@ -8,4 +8,4 @@ CREATE TABLE feed_follows (
 );
 
 -- +goose Down
-DROP TABLE feeds;
\ No newline at end of file
+DROP TABLE feed_follows;
\ No newline at end of file
@@ -0,0 +1,21 @@
+-- +goose Up
+-- Fever clients identify feeds and items by integer ids and authenticate
+-- with md5(username:password)
+ALTER TABLE users
+ADD COLUMN fever_api_key TEXT UNIQUE;
+
+ALTER TABLE feeds
+ADD COLUMN fever_id BIGSERIAL NOT NULL UNIQUE;
+
+ALTER TABLE posts
+ADD COLUMN fever_id BIGSERIAL NOT NULL UNIQUE;
+
+-- +goose Down
+ALTER TABLE posts
+DROP COLUMN fever_id;
+
+ALTER TABLE feeds
+DROP COLUMN fever_id;
+
+ALTER TABLE users
+DROP COLUMN fever_api_key;
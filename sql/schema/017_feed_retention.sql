@@ -0,0 +1,16 @@
+-- +goose Up
+-- per-feed overrides of the retention set in the config file: NULL falls back
+-- to it and 0 keeps posts forever
+ALTER TABLE feeds
+ADD COLUMN retention_max_age_days INT,
+ADD COLUMN retention_max_posts INT;
+
+-- prune ranks each feed's posts by publication date
+CREATE INDEX posts_feed_id_published_at_idx ON posts (feed_id, published_at DESC);
+
+-- +goose Down
+DROP INDEX posts_feed_id_published_at_idx;
+
+ALTER TABLE feeds
+DROP COLUMN retention_max_age_days,
+DROP COLUMN retention_max_posts;
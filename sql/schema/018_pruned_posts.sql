@@ -0,0 +1,12 @@
+-- +goose Up
+-- items prune deleted, so agg doesn't store them again while the feed still
+-- lists them
+CREATE TABLE pruned_posts (
+    feed_id UUID NOT NULL REFERENCES feeds (id) ON DELETE CASCADE,
+    guid TEXT NOT NULL,
+    pruned_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (feed_id, guid)
+);
+
+-- +goose Down
+DROP TABLE pruned_posts;
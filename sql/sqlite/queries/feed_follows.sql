@@ -0,0 +1,38 @@
+-- name: CreateFeedFollow :one
+INSERT INTO feed_follows (id, created_at, user_id, feed_id, category)
+VALUES (
+    ?,
+    ?,
+    ?,
+    ?,
+    ?
+)
+RETURNING *;
+
+-- name: GetFeedFollowNames :one
+-- sqlite can't select from an INSERT, so CreateFeedFollow's names are
+-- looked up separately
+SELECT
+    feed_follows.*,
+    feeds.name AS feed_name,
+    users.name AS user_name
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN users ON feed_follows.user_id = users.id
+WHERE feed_follows.id = ?;
+
+-- name: GetFeedFollowsForUser :many
+SELECT
+    feed_follows.*,
+    feeds.name AS feed_name,
+    feeds.url AS feed_url,
+    users.name AS user_name
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN users ON feed_follows.user_id = users.id
+WHERE feed_follows.user_id = ?
+ORDER BY feed_follows.category, feeds.name;
+
+-- name: RemoveFeedFollow :exec
+DELETE FROM feed_follows
+WHERE user_id = ? AND feed_id = ?;
@@ -0,0 +1,69 @@
+-- name: CreateFeed :one
+-- sqlite has no sequences, and writes are serialized, so fever ids are
+-- simply allocated past the highest one
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id, fever_id)
+VALUES (
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    (SELECT COALESCE(MAX(fever_id), 0) + 1 FROM feeds)
+)
+RETURNING *;
+
+-- name: GetFeed :one
+SELECT * FROM feeds
+WHERE url = ?;
+
+-- name: GetFeedById :one
+SELECT * FROM feeds
+WHERE id = ?;
+
+-- name: GetFeeds :many
+SELECT * FROM feeds;
+
+-- name: MarkFeedFetched :exec
+UPDATE feeds
+SET last_fetched_at = ?2,
+    updated_at = ?2,
+    etag = ?3,
+    last_modified = ?4,
+    error_count = 0,
+    last_error = NULL,
+    last_error_at = NULL
+WHERE id = ?1;
+
+-- name: MarkFeedFailed :exec
+UPDATE feeds
+SET last_fetched_at = ?2,
+    error_count = error_count + 1,
+    last_error = ?3,
+    last_error_at = ?2
+WHERE id = ?1;
+
+-- name: GetNextFeedsToFetch :many
+-- claims a batch of stale feeds by stamping last_fetched_at; sqlite
+-- serializes writers, so no row locking is needed. Failing feeds back off
+-- exponentially: 1m, 2m, 4m, ... capped at ~17h.
+UPDATE feeds
+SET last_fetched_at = sqlc.arg(last_fetched_at)
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE (last_fetched_at IS NULL OR julianday(last_fetched_at) < julianday(sqlc.arg(last_fetched_at)))
+    AND (
+        error_count = 0
+        OR julianday(last_error_at) + (1 << MIN(error_count - 1, 10)) / 1440.0 < julianday(sqlc.arg(last_fetched_at))
+    )
+    ORDER BY julianday(last_fetched_at) ASC NULLS FIRST
+    LIMIT CAST(sqlc.arg(limit) AS INT)
+)
+RETURNING *;
+
+-- name: SetFeedRetention :exec
+UPDATE feeds
+SET retention_max_age_days = ?2,
+    retention_max_posts = ?3,
+    updated_at = ?4
+WHERE id = ?1;
@@ -0,0 +1,73 @@
+-- name: GetUserByFeverKey :one
+SELECT * FROM users
+WHERE fever_api_key = ?;
+
+-- name: SetUserFeverKey :exec
+UPDATE users
+SET fever_api_key = ?2,
+    updated_at = ?3
+WHERE id = ?1;
+
+-- name: GetFeverFeedsForUser :many
+SELECT
+    feeds.fever_id,
+    feeds.name,
+    feeds.url,
+    feeds.last_fetched_at,
+    feed_follows.category
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = ?
+ORDER BY feeds.name;
+
+-- name: GetFeverItemsForUser :many
+-- pages forward from since_id, or backward from max_id when it is given.
+-- sqlite can't bind arrays, so with_ids is a JSON array, or NULL for no filter.
+-- sqlc leaves named params inside function calls alone, hence ?3 and ?4.
+SELECT
+    posts.id,
+    posts.fever_id,
+    feeds.fever_id AS feed_fever_id,
+    posts.title,
+    posts.url,
+    posts.description,
+    posts.published_at,
+    CAST(COALESCE(post_states.read, FALSE) AS BOOLEAN) AS is_read,
+    CAST(COALESCE(post_states.starred, FALSE) AS BOOLEAN) AS is_saved
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = @user_id
+AND (posts.fever_id > sqlc.narg(since_id) OR sqlc.narg(since_id) IS NULL)
+AND (posts.fever_id < sqlc.narg(max_id) OR sqlc.narg(max_id) IS NULL)
+AND (posts.fever_id IN (SELECT value FROM json_each(?4)) OR sqlc.narg(with_ids) IS NULL)
+ORDER BY
+    CASE WHEN ?3 IS NULL THEN posts.fever_id ELSE -posts.fever_id END
+LIMIT @max_items;
+
+-- name: CountPostsForUser :one
+SELECT COUNT(*) FROM feed_follows
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = ?;
+
+-- name: GetUnreadFeverIDsForUser :many
+SELECT posts.fever_id FROM feed_follows
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = ? AND post_states.read IS NOT TRUE
+ORDER BY posts.fever_id;
+
+-- name: GetSavedFeverIDsForUser :many
+SELECT posts.fever_id FROM post_states
+INNER JOIN posts ON post_states.post_id = posts.id
+WHERE post_states.user_id = ? AND post_states.starred
+ORDER BY posts.fever_id;
+
+-- name: GetPostByFeverID :one
+SELECT * FROM posts
+WHERE fever_id = ?;
+
+-- name: GetFeedByFeverID :one
+SELECT * FROM feeds
+WHERE fever_id = ?;
@@ -0,0 +1,77 @@
+-- name: MarkPostRead :exec
+INSERT INTO post_states (user_id, post_id, read, read_at)
+VALUES (
+    ?,
+    ?,
+    TRUE,
+    ?
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE,
+    read_at = COALESCE(post_states.read_at, excluded.read_at);
+
+-- name: MarkAllPostsRead :execrows
+-- marks every post in the user's followed feeds read, optionally only those
+-- of one feed or category, or ingested before a point in time
+INSERT INTO post_states (user_id, post_id, read, read_at)
+SELECT feed_follows.user_id, posts.id, TRUE, @read_at
+FROM posts
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = @user_id
+AND (posts.feed_id = sqlc.narg(feed_id) OR sqlc.narg(feed_id) IS NULL)
+AND (feed_follows.category = sqlc.narg(category) OR sqlc.narg(category) IS NULL)
+AND (sqlc.narg(created_before) IS NULL OR julianday(posts.created_at) < julianday(sqlc.narg(created_before)))
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE,
+    read_at = excluded.read_at
+WHERE NOT post_states.read;
+
+-- name: GetUnreadCountsForUser :many
+SELECT
+    feeds.id AS feed_id,
+    feeds.name AS feed_name,
+    COUNT(CASE WHEN post_states.read IS NOT TRUE THEN posts.id END) AS unread
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+LEFT JOIN posts ON posts.feed_id = feeds.id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = ?
+GROUP BY feeds.id, feeds.name
+ORDER BY feeds.name;
+
+-- name: SetPostStarred :exec
+INSERT INTO post_states (user_id, post_id, starred, starred_at)
+VALUES (
+    ?,
+    ?,
+    ?,
+    ?
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET starred = excluded.starred,
+    starred_at = excluded.starred_at;
+
+-- name: GetStarredPost :one
+-- finds a post the user starred, whether or not they still follow its feed
+SELECT posts.* FROM post_states
+INNER JOIN posts ON post_states.post_id = posts.id
+WHERE post_states.post_id = ? AND post_states.user_id = ? AND post_states.starred;
+
+-- name: GetStarredPostsForUser :many
+-- starred posts stay listed even after the user unfollows their feed
+SELECT
+    feeds.name AS feed_name,
+    posts.*,
+    post_states.starred_at
+FROM post_states
+INNER JOIN posts ON post_states.post_id = posts.id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE post_states.user_id = ? AND post_states.starred
+ORDER BY julianday(post_states.starred_at) DESC
+LIMIT ?;
+
+-- name: MarkPostUnread :exec
+UPDATE post_states
+SET read = FALSE,
+    read_at = NULL
+WHERE user_id = ? AND post_id = ?;
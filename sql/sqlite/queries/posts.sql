@@ -0,0 +1,179 @@
+-- name: CreatePost :one
+-- inserts a new post, or updates it in place when the item was edited since
+-- it was last fetched. Unchanged items return no rows. A post keeps its id
+-- when updated, which is how inserted tells the two apart.
+INSERT INTO posts (id, created_at, updated_at, published_at, url, feed_id, title, description, guid, content_hash, fever_id)
+VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4,
+    ?5,
+    ?6,
+    ?7,
+    ?8,
+    ?9,
+    ?10,
+    (SELECT COALESCE(MAX(fever_id), 0) + 1 FROM posts)
+)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = excluded.title,
+    url = excluded.url,
+    description = excluded.description,
+    updated_at = excluded.updated_at,
+    content_hash = excluded.content_hash
+WHERE posts.content_hash <> excluded.content_hash
+RETURNING
+    id, title, url, description, created_at, updated_at, published_at,
+    feed_id, guid, content_hash, search, fever_id,
+    (id = ?1) AS inserted;
+
+-- name: AdoptLegacyPostGUID :exec
+-- posts stored before guids were tracked have their url as a placeholder guid
+-- and no content hash. The first fetch that sees the item's real guid moves
+-- the post onto it, so CreatePost updates it instead of storing a copy. OR
+-- IGNORE leaves the post alone when the guid is already taken.
+UPDATE OR IGNORE posts
+SET guid = sqlc.arg(guid)
+WHERE posts.feed_id = sqlc.arg(feed_id)
+    AND posts.guid = sqlc.arg(url)
+    AND posts.url = sqlc.arg(url)
+    AND posts.content_hash = '';
+
+-- name: GetPostsForUser :many
+SELECT
+    feeds.name AS feed_name,
+    users.name AS user_name,
+    posts.*
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN users ON feed_follows.user_id = users.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = ?
+ORDER BY julianday(posts.published_at) DESC
+LIMIT ? OFFSET ?;
+
+-- name: GetUnreadPostsForUser :many
+SELECT
+    feeds.name AS feed_name,
+    users.name AS user_name,
+    posts.*
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN users ON feed_follows.user_id = users.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = ? AND post_states.read IS NOT TRUE
+ORDER BY julianday(posts.published_at) DESC
+LIMIT ?;
+
+-- name: GetPost :one
+SELECT * FROM posts
+WHERE id = ?;
+
+-- name: GetFollowedPost :one
+-- returns no rows unless the user follows the post's feed
+SELECT posts.*, feeds.name AS feed_name FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE posts.id = ? AND feed_follows.user_id = ?;
+
+-- name: SearchPostsForUser :many
+-- query uses FTS5 syntax; bm25 scores better matches lower, so it is negated
+-- to rank like postgres' ts_rank
+SELECT
+    feeds.name AS feed_name,
+    posts.*,
+    CAST(-bm25(posts_fts) AS REAL) AS "rank"
+FROM posts_fts
+INNER JOIN posts ON posts.fever_id = posts_fts.rowid
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+WHERE posts_fts.search MATCH @query
+AND feed_follows.user_id = @user_id
+ORDER BY "rank" DESC, julianday(posts.published_at) DESC
+LIMIT @max_results;
+
+-- name: GetTimelineForUser :many
+-- optionally narrowed to one followed feed, or to a category tag and the
+-- folders nested below it
+SELECT
+    feeds.name AS feed_name,
+    feeds.url AS feed_url,
+    posts.*
+FROM feed_follows
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
+INNER JOIN posts ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = @user_id
+AND (feed_follows.feed_id = sqlc.narg(feed_id) OR sqlc.narg(feed_id) IS NULL)
+AND (
+    feed_follows.category = sqlc.narg(category)
+    OR feed_follows.category LIKE sqlc.narg(category) || '/%'
+    OR sqlc.narg(category) IS NULL
+)
+ORDER BY julianday(posts.published_at) DESC
+LIMIT @max_posts;
+
+-- name: GetPrunablePosts :many
+-- lists the posts past their feed's retention: older than the max age, or
+-- beyond the newest max posts. A feed's own limits override the defaults and
+-- 0 means no limit. Starred posts are always kept, and so are posts a
+-- follower hasn't read yet until they pass the max age.
+-- sqlc can't follow columns computed in a CTE or subquery here, so unlike
+-- postgres this counts the newer posts instead of using row_number().
+SELECT
+    posts.id,
+    posts.feed_id,
+    feeds.name AS feed_name,
+    feeds.url AS feed_url
+FROM posts
+INNER JOIN feeds ON feeds.id = posts.feed_id
+WHERE NOT EXISTS (
+    SELECT 1 FROM post_states
+    WHERE post_states.post_id = posts.id AND post_states.starred
+)
+AND (
+    (
+        COALESCE(feeds.retention_max_age_days, CAST(sqlc.arg(default_max_age_days) AS INT)) > 0
+        AND julianday(posts.published_at) < julianday(sqlc.arg(now)) - COALESCE(feeds.retention_max_age_days, CAST(sqlc.arg(default_max_age_days) AS INT))
+    )
+    OR (
+        COALESCE(feeds.retention_max_posts, CAST(sqlc.arg(default_max_posts) AS INT)) > 0
+        AND COALESCE(feeds.retention_max_posts, CAST(sqlc.arg(default_max_posts) AS INT)) <= (
+            SELECT COUNT(*) FROM posts AS newer
+            WHERE newer.feed_id = posts.feed_id
+            AND (
+                julianday(newer.published_at) > julianday(posts.published_at)
+                OR (julianday(newer.published_at) = julianday(posts.published_at) AND newer.id < posts.id)
+            )
+        )
+        AND NOT EXISTS (
+            SELECT 1 FROM feed_follows
+            LEFT JOIN post_states ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+            WHERE feed_follows.feed_id = posts.feed_id AND post_states.read IS NOT TRUE
+        )
+    )
+)
+ORDER BY feeds.name;
+
+-- name: DeleteUnstarredPosts :many
+-- checks for stars again in case one was added since the posts were listed,
+-- and returns the feed and guid of every deleted post
+DELETE FROM posts
+WHERE id IN (sqlc.slice(ids))
+AND NOT EXISTS (
+    SELECT 1 FROM post_states
+    WHERE post_states.post_id = posts.id AND post_states.starred
+)
+RETURNING feed_id, guid;
+
+-- name: RecordPrunedPost :exec
+INSERT INTO pruned_posts (feed_id, guid, pruned_at)
+VALUES (?, ?, ?)
+ON CONFLICT DO NOTHING;
+
+-- name: IsPostPruned :one
+SELECT EXISTS (
+    SELECT 1 FROM pruned_posts
+    WHERE feed_id = ? AND guid = ?
+);
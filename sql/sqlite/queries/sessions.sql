@@ -0,0 +1,22 @@
+-- name: CreateSession :exec
+INSERT INTO sessions (token_hash, user_id, created_at, expires_at)
+VALUES (
+    ?,
+    ?,
+    ?,
+    ?
+);
+
+-- name: GetUserBySession :one
+SELECT users.* FROM sessions
+INNER JOIN users ON sessions.user_id = users.id
+WHERE sessions.token_hash = ? AND julianday(sessions.expires_at) > julianday(sqlc.arg(expires_at));
+
+-- name: DeleteSession :exec
+DELETE FROM sessions
+WHERE token_hash = ?;
+
+-- name: DeleteSessionsForUser :execrows
+-- signs the user out everywhere except the session given
+DELETE FROM sessions
+WHERE user_id = ? AND token_hash <> ?;
@@ -0,0 +1,41 @@
+-- name: CreateUser :one
+INSERT INTO users (id, created_at, updated_at, name, api_key_hash, password_hash)
+VALUES (
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    ?
+)
+RETURNING *;
+
+-- name: GetUserByName :one
+SELECT * FROM users
+WHERE name = ?;
+
+-- name: GetUserById :one
+SELECT * FROM users
+WHERE id = ?;
+
+-- name: DeleteUsers :exec
+DELETE FROM users;
+
+-- name: GetUsers :many
+SELECT * FROM users;
+
+-- name: GetUserByAPIKey :one
+SELECT * FROM users
+WHERE api_key_hash = ?;
+
+-- name: SetUserAPIKey :exec
+UPDATE users
+SET api_key_hash = ?2,
+    updated_at = ?3
+WHERE id = ?1;
+
+-- name: SetUserPassword :exec
+UPDATE users
+SET password_hash = ?2,
+    updated_at = ?3
+WHERE id = ?1;
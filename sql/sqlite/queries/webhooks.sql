@@ -0,0 +1,51 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, user_id, feed_id, url, secret)
+VALUES (
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    ?
+)
+RETURNING *;
+
+-- name: GetWebhooksForUser :many
+SELECT webhooks.*, feeds.url AS feed_url FROM webhooks
+LEFT JOIN feeds ON webhooks.feed_id = feeds.id
+WHERE webhooks.user_id = ?
+ORDER BY julianday(webhooks.created_at);
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE id = ? AND user_id = ?;
+
+-- name: GetWebhooksForFeed :many
+-- webhooks without a feed only fire for feeds their owner follows
+SELECT webhooks.* FROM webhooks
+WHERE webhooks.feed_id = @feed_id
+OR (
+    webhooks.feed_id IS NULL
+    AND EXISTS (
+        SELECT 1 FROM feed_follows
+        WHERE feed_follows.user_id = webhooks.user_id AND feed_follows.feed_id = @feed_id
+    )
+);
+
+-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, webhook_id, post_id, attempt, status_code, error, created_at)
+VALUES (
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    ?,
+    ?
+);
+
+-- name: GetLastWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE webhook_id = ?
+ORDER BY julianday(created_at) DESC
+LIMIT 1;
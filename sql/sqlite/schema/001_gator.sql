@@ -0,0 +1,129 @@
+-- +goose Up
+-- The SQLite schema matches sql/schema after all of its migrations, with
+-- columns in the same order so generated models line up. Keep both in step.
+CREATE TABLE users (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    api_key_hash TEXT UNIQUE,
+    password_hash TEXT,
+    fever_api_key TEXT UNIQUE
+);
+
+CREATE TABLE feeds (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    url TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    last_fetched_at TIMESTAMP,
+    etag TEXT,
+    last_modified TEXT,
+    error_count INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    last_error_at TIMESTAMP,
+    fever_id INTEGER NOT NULL UNIQUE
+);
+
+CREATE TABLE feed_follows (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    feed_id UUID NOT NULL REFERENCES feeds (id) ON DELETE CASCADE,
+    category TEXT NOT NULL DEFAULT '',
+    UNIQUE (user_id, feed_id)
+);
+
+CREATE TABLE posts (
+    id UUID PRIMARY KEY,
+    title TEXT NOT NULL,
+    url TEXT NOT NULL,
+    description TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    published_at TIMESTAMP NOT NULL,
+    feed_id UUID NOT NULL REFERENCES feeds (id) ON DELETE CASCADE,
+    guid TEXT NOT NULL,
+    content_hash TEXT NOT NULL DEFAULT '',
+    -- the document posts_fts indexes, standing in for the postgres tsvector
+    search ANY GENERATED ALWAYS AS (title || ' ' || description) VIRTUAL,
+    fever_id INTEGER NOT NULL UNIQUE,
+    UNIQUE (feed_id, guid)
+);
+
+CREATE VIRTUAL TABLE posts_fts USING fts5 (
+    search,
+    content = 'posts',
+    content_rowid = 'fever_id'
+);
+
+-- +goose StatementBegin
+CREATE TRIGGER posts_fts_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO posts_fts (rowid, search) VALUES (new.fever_id, new.search);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+    INSERT INTO posts_fts (posts_fts, rowid, search) VALUES ('delete', old.fever_id, old.search);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER posts_fts_update AFTER UPDATE ON posts BEGIN
+    INSERT INTO posts_fts (posts_fts, rowid, search) VALUES ('delete', old.fever_id, old.search);
+    INSERT INTO posts_fts (rowid, search) VALUES (new.fever_id, new.search);
+END;
+-- +goose StatementEnd
+
+CREATE TABLE post_states (
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    read BOOLEAN NOT NULL DEFAULT FALSE,
+    read_at TIMESTAMP,
+    starred BOOLEAN NOT NULL DEFAULT FALSE,
+    starred_at TIMESTAMP,
+    PRIMARY KEY (user_id, post_id)
+);
+
+CREATE TABLE sessions (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE webhooks (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    -- NULL delivers posts from every feed the user follows
+    feed_id UUID REFERENCES feeds (id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL
+);
+
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY,
+    webhook_id UUID NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    attempt INT NOT NULL,
+    status_code INT,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, created_at);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
+DROP TABLE sessions;
+DROP TABLE post_states;
+DROP TABLE posts_fts;
+DROP TABLE posts;
+DROP TABLE feed_follows;
+DROP TABLE feeds;
+DROP TABLE users;
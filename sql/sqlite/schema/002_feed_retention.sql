@@ -0,0 +1,12 @@
+-- +goose Up
+-- see sql/schema/017_feed_retention.sql
+ALTER TABLE feeds ADD COLUMN retention_max_age_days INT;
+ALTER TABLE feeds ADD COLUMN retention_max_posts INT;
+
+CREATE INDEX posts_feed_id_published_at_idx ON posts (feed_id, published_at DESC);
+
+-- +goose Down
+DROP INDEX posts_feed_id_published_at_idx;
+
+ALTER TABLE feeds DROP COLUMN retention_max_age_days;
+ALTER TABLE feeds DROP COLUMN retention_max_posts;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- see sql/schema/018_pruned_posts.sql
+CREATE TABLE pruned_posts (
+    feed_id UUID NOT NULL REFERENCES feeds (id) ON DELETE CASCADE,
+    guid TEXT NOT NULL,
+    pruned_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (feed_id, guid)
+);
+
+-- +goose Down
+DROP TABLE pruned_posts;
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jsleep/blog_aggregator/internal/database"
+	"github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+)
+
+const (
+	// newPostsChannel is the Postgres NOTIFY channel agg announces posts on
+	newPostsChannel = "new_posts"
+
+	streamBufferSize   = 16
+	streamPingInterval = 30 * time.Second
+)
+
+// postEvent announces a newly ingested post. Only ids are sent because NOTIFY
+// payloads are limited to 8000 bytes; subscribers load the post themselves.
+type postEvent struct {
+	Origin uuid.UUID `json:"origin"`
+	PostID uuid.UUID `json:"post_id"`
+	FeedID uuid.UUID `json:"feed_id"`
+}
+
+// postHub fans post events out to the SSE streams of this process. Events
+// come from posts this process ingests, when serve runs with --agg, and on
+// Postgres from NOTIFY, which relays the posts of separate agg processes.
+type postHub struct {
+	// id marks the events this process published, so the listener can
+	// skip them when they come back through Postgres
+	id uuid.UUID
+
+	mu     sync.Mutex
+	subs   map[chan postEvent]struct{}
+	closed bool
+}
+
+func newPostHub() *postHub {
+	return &postHub{
+		id:   uuid.New(),
+		subs: make(map[chan postEvent]struct{}),
+	}
+}
+
+// subscribe returns a channel of events that is closed by unsubscribe or
+// when the hub shuts down
+func (h *postHub) subscribe() (<-chan postEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan postEvent, streamBufferSize)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	h.subs[ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *postHub) publish(event postEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs {
+		// a subscriber that can't keep up misses events rather than stalling agg
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// close ends every open stream so the HTTP server can shut down
+func (h *postHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// announcePost tells this process's streams and, through NOTIFY, any serve
+// process sharing the database about a post that was just created
+func announcePost(s *state, post database.CreatePostRow) {
+	event := postEvent{
+		Origin: s.hub.id,
+		PostID: post.ID,
+		FeedID: post.FeedID,
+	}
+	s.hub.publish(event)
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		fmt.Printf("Error encoding post event: %v\n", err)
+		return
+	}
+	if err := s.db.NotifyNewPost(context.Background(), string(payload)); err != nil {
+		fmt.Printf("Error notifying new post: %v\n", err)
+	}
+}
+
+// listenForPosts relays posts announced by other processes to the hub until
+// ctx is done
+func listenForPosts(ctx context.Context, s *state) error {
+	listener := pq.NewListener(s.Config.DBUrl, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Post listener: %v", err)
+		}
+	})
+	if err := listener.Listen(newPostsChannel); err != nil {
+		listener.Close()
+		return err
+	}
+
+	go func() {
+		defer listener.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-listener.Notify:
+				// nil is sent after a reconnect; anything missed meanwhile is lost
+				if n == nil {
+					continue
+				}
+				var event postEvent
+				if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+					log.Printf("Invalid post event: %v", err)
+					continue
+				}
+				if event.Origin != s.hub.id {
+					s.hub.publish(event)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// apiStreamPosts streams the user's new posts as Server-Sent Events
+func apiStreamPosts(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	// without NOTIFY nothing would ever arrive from a separate agg process
+	if s.dialect == goose.DialectSQLite3 && !s.aggregating {
+		respondWithError(w, http.StatusNotImplemented, "streaming from sqlite needs serve --agg")
+		return
+	}
+
+	events, unsubscribe := s.hub.subscribe()
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-ping.C:
+			// comments keep proxies from closing an idle stream
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			post, err := s.db.GetFollowedPost(r.Context(), database.GetFollowedPostParams{
+				ID:     event.PostID,
+				UserID: user.ID,
+			})
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				log.Printf("Error loading streamed post: %v", err)
+				continue
+			}
+
+			b, err := json.Marshal(databaseFollowedPostToPost(post))
+			if err != nil {
+				log.Printf("Error marshalling JSON: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: post\ndata: %s\n\n", post.ID, b); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// sseEvent is one Server-Sent Event read off a stream
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// openStream connects to the post stream and returns its events, which end
+// when the server closes the stream
+func openStream(t *testing.T, baseURL, apiKey string) <-chan sseEvent {
+	t.Helper()
+	r, err := http.NewRequest(http.MethodGet, baseURL+"/v1/posts/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "ApiKey "+apiKey)
+
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream: status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("stream: content type %q", ct)
+	}
+
+	events := make(chan sseEvent)
+	go func() {
+		defer close(events)
+		var event sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			field, value, _ := strings.Cut(scanner.Text(), ": ")
+			switch field {
+			case "id":
+				event.ID = value
+			case "event":
+				event.Event = value
+			case "data":
+				event.Data = value
+			case "":
+				if event.Event != "" {
+					events <- event
+				}
+				event = sseEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) (sseEvent, bool) {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		return event, ok
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the stream")
+		return sseEvent{}, false
+	}
+}
+
+func TestStreamPosts(t *testing.T) {
+	s := newTestState(t)
+	registerUser(t, s, "alice")
+	mine := newFeedServer(t, "Mine", testItem(1, "One", "first"))
+	addFeed(t, s, "Mine", mine)
+	aliceKey := newAPIKey(t, s)
+
+	registerUser(t, s, "bob")
+	theirs := newFeedServer(t, "Theirs", testItem(2, "Two", "second"))
+	addFeed(t, s, "Theirs", theirs)
+
+	srv := httptest.NewServer(newRouter(s))
+	defer srv.Close()
+
+	if code := apiRequest(t, srv, http.MethodGet, "/v1/posts/stream", "", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("stream without a key: status %d", code)
+	}
+
+	events := openStream(t, srv.URL, aliceKey)
+
+	// bob's new post is ingested first, so it would arrive first if alice,
+	// who doesn't follow his feed, were sent it
+	theirs.setItems(testItem(2, "Two", "second"), testItem(3, "Three", "third"))
+	mustRun(t, s, "agg", "--once")
+	mine.setItems(testItem(1, "One", "first"), testItem(4, "Four", "fourth"))
+	mustRun(t, s, "agg", "--once")
+
+	event, ok := nextEvent(t, events)
+	if !ok {
+		t.Fatal("the stream ended early")
+	}
+	var post Post
+	if err := json.Unmarshal([]byte(event.Data), &post); err != nil {
+		t.Fatal(err)
+	}
+	if event.Event != "post" || post.Title != "Four" || post.FeedName != "Mine" || event.ID != post.ID.String() {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	// shutting the hub down ends open streams
+	s.hub.close()
+	if event, ok := nextEvent(t, events); ok {
+		t.Errorf("unexpected event after shutdown: %+v", event)
+	}
+}
+
+func TestServeAggregates(t *testing.T) {
+	s := newSQLiteState(t)
+	registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"))
+	addFeed(t, s, "Example", fs)
+	key := newAPIKey(t, s)
+
+	// on sqlite only serve's own agg can feed the stream
+	srv := httptest.NewServer(newRouter(s))
+	code := apiRequest(t, srv, http.MethodGet, "/v1/posts/stream", key, "", nil)
+	srv.Close()
+	if code != http.StatusNotImplemented {
+		t.Errorf("stream on sqlite without --agg: status %d", code)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	if _, err := run(t, s, "serve", addr, "--agg", "soon"); err == nil {
+		t.Error("expected an error for an invalid interval")
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := run(t, s, "serve", addr, "--agg", "20ms")
+		errc <- err
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get("http://" + addr + "/v1/healthz")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server never came up: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	events := openStream(t, "http://"+addr, key)
+	fs.setItems(testItem(1, "One", "first"), testItem(2, "Two", "second"))
+	event, ok := nextEvent(t, events)
+	if !ok || !strings.Contains(event.Data, `"title":"Two"`) {
+		t.Errorf("unexpected event: %+v (open %v)", event, ok)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("serve returned %v", err)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("serve didn't stop on SIGINT")
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+const defaultTimelineLength = 50
+
+// RSS 2.0 and Atom documents gator publishes; the parsing types in feed.go
+// only model what we read
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string       `xml:"title"`
+	Link          string       `xml:"link"`
+	Description   string       `xml:"description"`
+	LastBuildDate string       `xml:"lastBuildDate"`
+	Generator     string       `xml:"generator"`
+	Items         []rssOutItem `xml:"item"`
+}
+
+type rssOutItem struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	PubDate     string    `xml:"pubDate"`
+	GUID        rssGUID   `xml:"guid"`
+	Source      rssSource `xml:"source"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssSource struct {
+	URL  string `xml:"url,attr"`
+	Name string `xml:",chardata"`
+}
+
+type atomDocument struct {
+	XMLName   xml.Name       `xml:"http://www.w3.org/2005/Atom feed"`
+	ID        string         `xml:"id"`
+	Title     string         `xml:"title"`
+	Updated   string         `xml:"updated"`
+	Links     []atomLink     `xml:"link"`
+	Author    atomAuthor     `xml:"author"`
+	Generator string         `xml:"generator"`
+	Entries   []atomOutEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomOutEntry struct {
+	ID        string   `xml:"id"`
+	Title     string   `xml:"title"`
+	Link      atomLink `xml:"link"`
+	Published string   `xml:"published"`
+	Updated   string   `xml:"updated"`
+	Summary   atomText `xml:"summary"`
+	Source    struct {
+		ID    string `xml:"id"`
+		Title string `xml:"title"`
+	} `xml:"source"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// timelineFilter narrows a timeline to one followed feed or one category tag
+type timelineFilter struct {
+	FeedID   uuid.NullUUID
+	Category sql.NullString
+	Limit    int32
+}
+
+func renderFeedHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "render-feed"
+	if cmd.Command != "render-feed" {
+		return fmt.Errorf("invalid command")
+	}
+
+	atom, args := popFlag(cmd.Args, "--atom")
+	feedURL, args, err := popFlagValue(args, "--feed")
+	if err != nil {
+		return err
+	}
+	tag, args, err := popFlagValue(args, "--tag")
+	if err != nil {
+		return err
+	}
+
+	// Check if the arguments are valid
+	if len(args) < 1 {
+		return fmt.Errorf("missing output file argument")
+	}
+
+	filter := timelineFilter{
+		Category: nullString(tag),
+		Limit:    defaultTimelineLength,
+	}
+	if feedURL != "" {
+		feed, err := s.db.GetFeed(context.Background(), feedURL)
+		if err != nil {
+			return err
+		}
+		filter.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	format := "rss"
+	if atom {
+		format = "atom"
+	}
+	if err := renderTimeline(context.Background(), s, f, format, timelineSiteURL(s), "", user, filter); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %s feed to %s\n", format, args[0])
+
+	return f.Close()
+}
+
+// apiTimeline serves the same document as render-feed so readers can subscribe to it
+func apiTimeline(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "rss"
+	}
+	if format != "rss" && format != "atom" {
+		respondWithError(w, http.StatusBadRequest, "format must be rss or atom")
+		return
+	}
+
+	filter := timelineFilter{
+		Category: nullString(query.Get("tag")),
+		Limit:    defaultTimelineLength,
+	}
+	if v := query.Get("feed_id"); v != "" {
+		feedID, err := uuid.Parse(v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid feed_id")
+			return
+		}
+		filter.FeedID = uuid.NullUUID{UUID: feedID, Valid: true}
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+			return
+		}
+		filter.Limit = int32(n)
+	}
+
+	contentType := "application/rss+xml; charset=utf-8"
+	if format == "atom" {
+		contentType = "application/atom+xml; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	siteURL := fmt.Sprintf("%s://%s/", scheme, r.Host)
+	selfURL := siteURL + strings.TrimPrefix(r.URL.Path, "/")
+
+	if err := renderTimeline(r.Context(), s, w, format, siteURL, selfURL, user, filter); err != nil {
+		respondWithDBError(w, err)
+	}
+}
+
+// timelineSiteURL is the gator the timeline links back to when it isn't
+// being served: base_url from the config file, or serve's default address
+func timelineSiteURL(s *state) string {
+	if s.Config.BaseURL != "" {
+		return s.Config.BaseURL
+	}
+	return "http://localhost" + defaultServeAddr + "/"
+}
+
+// renderTimeline writes the user's merged timeline as an RSS 2.0 or Atom
+// document. siteURL is the gator it comes from, which RSS requires a link to;
+// selfURL is where the document is served from, if anywhere.
+func renderTimeline(ctx context.Context, s *state, w io.Writer, format, siteURL, selfURL string, user database.User, filter timelineFilter) error {
+	posts, err := s.db.GetTimelineForUser(ctx, database.GetTimelineForUserParams{
+		UserID:   user.ID,
+		FeedID:   filter.FeedID,
+		Category: filter.Category,
+		MaxPosts: filter.Limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	title := fmt.Sprintf("%s's gator timeline", user.Name)
+	if filter.Category.Valid {
+		title = fmt.Sprintf("%s: %s", title, filter.Category.String)
+	}
+
+	// the feed was last updated when any of its posts was; they are sorted
+	// by publication, and an older post may have been edited since
+	updated := user.CreatedAt
+	for _, post := range posts {
+		if post.UpdatedAt.After(updated) {
+			updated = post.UpdatedAt
+		}
+	}
+
+	var doc any
+	switch format {
+	case "atom":
+		doc = timelineAtom(title, siteURL, selfURL, user, updated, posts)
+	default:
+		doc = timelineRSS(title, siteURL, updated, posts)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func timelineRSS(title, link string, updated time.Time, posts []database.GetTimelineForUserRow) rssDocument {
+	doc := rssDocument{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         title,
+			Link:          link,
+			Description:   "Posts merged from the feeds followed in gator",
+			LastBuildDate: updated.Format(time.RFC1123Z),
+			Generator:     "gator",
+		},
+	}
+
+	for _, post := range posts {
+		doc.Channel.Items = append(doc.Channel.Items, rssOutItem{
+			Title:       post.Title,
+			Link:        post.Url,
+			Description: post.Description,
+			PubDate:     post.PublishedAt.Format(time.RFC1123Z),
+			// guids are only unique per feed, so publish our own post id instead
+			GUID:   rssGUID{IsPermaLink: "false", Value: "urn:uuid:" + post.ID.String()},
+			Source: rssSource{URL: post.FeedUrl, Name: post.FeedName},
+		})
+	}
+
+	return doc
+}
+
+func timelineAtom(title, siteURL, selfURL string, user database.User, updated time.Time, posts []database.GetTimelineForUserRow) atomDocument {
+	doc := atomDocument{
+		ID:        "urn:uuid:" + user.ID.String(),
+		Title:     title,
+		Updated:   updated.Format(time.RFC3339),
+		Links:     []atomLink{{Href: siteURL, Rel: "alternate"}},
+		Author:    atomAuthor{Name: user.Name},
+		Generator: "gator",
+	}
+	if selfURL != "" {
+		doc.Links = append(doc.Links, atomLink{Href: selfURL, Rel: "self"})
+	}
+
+	for _, post := range posts {
+		entry := atomOutEntry{
+			ID:        "urn:uuid:" + post.ID.String(),
+			Title:     post.Title,
+			Link:      atomLink{Href: post.Url, Rel: "alternate"},
+			Published: post.PublishedAt.Format(time.RFC3339),
+			Updated:   post.UpdatedAt.Format(time.RFC3339),
+			Summary:   atomText{Type: "html", Value: post.Description},
+		}
+		entry.Source.ID = post.FeedUrl
+		entry.Source.Title = post.FeedName
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return doc
+}
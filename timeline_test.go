@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderFeed(t *testing.T) {
+	s := newTestState(t)
+	registerUser(t, s, "alice")
+	one := newFeedServer(t, "One", testItem(1, "A", "a"), testItem(2, "B", "b"))
+	two := newFeedServer(t, "Two", testItem(3, "C", "c"))
+	addFeed(t, s, "One", one)
+	addFeed(t, s, "Two", two)
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "timeline.xml")
+	out := mustRun(t, s, "render-feed", path)
+	if !strings.Contains(out, "Wrote rss feed to "+path) {
+		t.Errorf("unexpected render-feed output:\n%s", out)
+	}
+	var rss rssDocument
+	readXML(t, path, &rss)
+	if rss.Channel.Title != "alice's gator timeline" || len(rss.Channel.Items) != 3 {
+		t.Fatalf("unexpected rss document: %+v", rss.Channel)
+	}
+	// merged across feeds, newest first
+	if item := rss.Channel.Items[0]; item.Title != "C" || item.Source.Name != "Two" || item.Source.URL != two.URL {
+		t.Errorf("unexpected first item: %+v", item)
+	}
+	// RSS requires a channel link, which defaults to where serve listens
+	if rss.Channel.Link != "http://localhost:8080/" {
+		t.Errorf("unexpected channel link %q", rss.Channel.Link)
+	}
+
+	// editing an older post updates the document, though it stays in place
+	s.Config.BaseURL = "https://gator.example.com/"
+	built := rss.Channel.LastBuildDate
+	time.Sleep(time.Second)
+	one.setItems(testItem(1, "A (edited)", "a"), testItem(2, "B", "b"))
+	mustRun(t, s, "agg", "--once")
+	mustRun(t, s, "render-feed", path)
+	rss = rssDocument{}
+	readXML(t, path, &rss)
+	if rss.Channel.Items[2].Title != "A (edited)" || rss.Channel.LastBuildDate == built {
+		t.Errorf("an edit didn't update the document: built %s, then %s", built, rss.Channel.LastBuildDate)
+	}
+	if rss.Channel.Link != "https://gator.example.com/" {
+		t.Errorf("channel link %q ignores base_url", rss.Channel.Link)
+	}
+
+	mustRun(t, s, "render-feed", "--atom", "--feed", one.URL, path)
+	var atom atomDocument
+	readXML(t, path, &atom)
+	if len(atom.Entries) != 2 {
+		t.Fatalf("expected only the posts of One, got %+v", atom.Entries)
+	}
+	if len(atom.Links) != 1 || atom.Links[0].Href != "https://gator.example.com/" {
+		t.Errorf("unexpected atom links: %+v", atom.Links)
+	}
+	for _, entry := range atom.Entries {
+		if entry.Source.Title != "One" || !strings.HasPrefix(entry.ID, "urn:uuid:") {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+	}
+
+	// feeds added by hand have no category
+	mustRun(t, s, "render-feed", "--tag", "Tech", path)
+	rss = rssDocument{}
+	readXML(t, path, &rss)
+	if rss.Channel.Title != "alice's gator timeline: Tech" || len(rss.Channel.Items) != 0 {
+		t.Errorf("unexpected tagged document: %+v", rss.Channel)
+	}
+
+	// served, the document links back to the server it came from
+	srv := httptest.NewServer(newRouter(s))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/v1/timeline?api_key=" + newAPIKey(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	rss = rssDocument{}
+	if err := xml.NewDecoder(resp.Body).Decode(&rss); err != nil {
+		t.Fatal(err)
+	}
+	if rss.Channel.Link != srv.URL+"/" || len(rss.Channel.Items) != 3 {
+		t.Errorf("unexpected served document: %+v", rss.Channel)
+	}
+
+	if _, err := run(t, s, "render-feed"); err == nil {
+		t.Error("expected an error without an output file")
+	}
+	if _, err := run(t, s, "render-feed", "--feed"); err == nil {
+		t.Error("expected an error for --feed without a url")
+	}
+	if _, err := run(t, s, "render-feed", "--feed", "https://example.com/unknown.xml", path); err == nil {
+		t.Error("expected an error for an unknown feed")
+	}
+}
+
+func readXML(t *testing.T, path string, v any) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(b, v); err != nil {
+		t.Fatalf("invalid xml: %v\n%s", err, b)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+const (
+	webhookMaxAttempts = 5
+	webhookRetryDelay  = 2 * time.Second
+	webhookTimeout     = 10 * time.Second
+
+	// webhookSignatureHeader carries "sha256=<hex hmac of the body>"
+	webhookSignatureHeader = "X-Gator-Signature"
+)
+
+// webhookPayload is the JSON body POSTed for every new post
+type webhookPayload struct {
+	Event string `json:"event"`
+	Feed  Feed   `json:"feed"`
+	Post  Post   `json:"post"`
+}
+
+// webhookSender delivers webhooks in the background; wait blocks until every
+// delivery, including its retries, has finished or been abandoned at shutdown
+type webhookSender struct {
+	client     *http.Client
+	retryDelay time.Duration
+	wg         sync.WaitGroup
+}
+
+func newWebhookSender(client *http.Client) *webhookSender {
+	return &webhookSender{
+		client:     client,
+		retryDelay: webhookRetryDelay,
+	}
+}
+
+// dispatch sends post to every webhook interested in feed. Retries stop once
+// ctx is done.
+func (ws *webhookSender) dispatch(ctx context.Context, s *state, feed database.Feed, post database.CreatePostRow) {
+	hooks, err := s.db.GetWebhooksForFeed(context.Background(), feed.ID)
+	if err != nil {
+		fmt.Printf("Error loading webhooks: %v\n", err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(webhookPayload{
+		Event: "post.created",
+		Feed:  databaseFeedToFeed(feed),
+		Post:  databaseCreatedPostToPost(post, feed.Name),
+	})
+	if err != nil {
+		fmt.Printf("Error encoding webhook payload: %v\n", err)
+		return
+	}
+
+	for _, hook := range hooks {
+		ws.wg.Add(1)
+		go func() {
+			defer ws.wg.Done()
+			ws.send(ctx, s, hook, post.ID, body)
+		}()
+	}
+}
+
+// send delivers body to hook, backing off exponentially between attempts and
+// logging each one to webhook_deliveries. An attempt in flight is finished,
+// bounded by the client's timeout, but no new one starts after ctx is done.
+func (ws *webhookSender) send(ctx context.Context, s *state, hook database.Webhook, postID uuid.UUID, body []byte) {
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		status, err := deliverWebhook(context.Background(), ws.client, hook.Url, hook.Secret, body)
+
+		delivery := database.CreateWebhookDeliveryParams{
+			ID:         uuid.New(),
+			WebhookID:  hook.ID,
+			PostID:     postID,
+			Attempt:    int32(attempt),
+			StatusCode: sql.NullInt32{Int32: int32(status), Valid: status != 0},
+			CreatedAt:  time.Now(),
+		}
+		if err != nil {
+			delivery.Error = nullString(err.Error())
+		}
+		if logErr := s.db.CreateWebhookDelivery(context.Background(), delivery); logErr != nil {
+			fmt.Printf("Error logging webhook delivery: %v\n", logErr)
+		}
+
+		if err == nil {
+			return
+		}
+		fmt.Printf("Webhook %s attempt %d failed: %v\n", hook.Url, attempt, err)
+
+		// the receiver rejected the request itself, sending it again won't help
+		if status >= 400 && status < 500 && status != http.StatusTooManyRequests {
+			return
+		}
+		if attempt == webhookMaxAttempts {
+			return
+		}
+
+		backoff := time.NewTimer(ws.retryDelay << (attempt - 1))
+		select {
+		case <-ctx.Done():
+			backoff.Stop()
+			fmt.Printf("Webhook %s: shutting down, not retrying\n", hook.Url)
+			return
+		case <-backoff.C:
+		}
+	}
+}
+
+func (ws *webhookSender) wait() {
+	ws.wg.Wait()
+}
+
+// deliverWebhook makes a single signed POST, returning the response status
+// (0 if there was none) and an error unless the receiver answered 2xx
+func deliverWebhook(ctx context.Context, client *http.Client, hookURL, secret string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gator")
+	req.Header.Set("X-Gator-Event", "post.created")
+	req.Header.Set(webhookSignatureHeader, signWebhook(secret, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// drain so the connection can be reused
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// signWebhook lets receivers verify a payload came from gator with the
+// secret printed by webhook-add
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func addWebhookHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "webhook-add"
+	if cmd.Command != "webhook-add" {
+		return fmt.Errorf("invalid command")
+	}
+
+	// --feed limits the webhook to one feed instead of everything the user follows
+	feedURL, args, err := popFlagValue(cmd.Args, "--feed")
+	if err != nil {
+		return err
+	}
+
+	// Check if the arguments are valid
+	if len(args) < 1 {
+		return fmt.Errorf("missing webhook url argument")
+	}
+	u, err := url.Parse(args[0])
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook url: %s", args[0])
+	}
+
+	var feedID uuid.NullUUID
+	if feedURL != "" {
+		feed, err := s.db.GetFeed(context.Background(), feedURL)
+		if err != nil {
+			return err
+		}
+		feedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	secret, _, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	hook, err := s.db.CreateWebhook(context.Background(), database.CreateWebhookParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UserID:    user.ID,
+		FeedID:    feedID,
+		Url:       u.String(),
+		Secret:    secret,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Webhook %s added\n", hook.ID)
+	fmt.Printf("Signing secret: %s\n", hook.Secret)
+	fmt.Printf("Requests carry %s: sha256=<hex HMAC-SHA256 of the body>\n", webhookSignatureHeader)
+
+	return nil
+}
+
+func listWebhooksHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "webhooks"
+	if cmd.Command != "webhooks" {
+		return fmt.Errorf("invalid command")
+	}
+
+	hooks, err := s.db.GetWebhooksForUser(context.Background(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(hooks) == 0 {
+		fmt.Println("No webhooks")
+		return nil
+	}
+
+	for _, hook := range hooks {
+		feed := "all followed feeds"
+		if hook.FeedUrl.Valid {
+			feed = hook.FeedUrl.String
+		}
+		fmt.Printf("* %s %s (%s)\n", hook.ID, hook.Url, feed)
+
+		delivery, err := s.db.GetLastWebhookDelivery(context.Background(), hook.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if delivery.Error.Valid {
+			fmt.Printf("  last delivery failed at %s: %s\n", delivery.CreatedAt.Format(time.RFC3339), delivery.Error.String)
+		} else {
+			fmt.Printf("  last delivered at %s (%d)\n", delivery.CreatedAt.Format(time.RFC3339), delivery.StatusCode.Int32)
+		}
+	}
+
+	return nil
+}
+
+func removeWebhookHandler(s *state, cmd command, user database.User) error {
+	// Check if the command is "webhook-remove"
+	if cmd.Command != "webhook-remove" {
+		return fmt.Errorf("invalid command")
+	}
+
+	// Check if the arguments are valid
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("missing webhook id argument")
+	}
+	id, err := uuid.Parse(cmd.Args[0])
+	if err != nil {
+		return fmt.Errorf("invalid webhook id: %s", cmd.Args[0])
+	}
+
+	removed, err := s.db.DeleteWebhook(context.Background(), database.DeleteWebhookParams{
+		ID:     id,
+		UserID: user.ID,
+	})
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return fmt.Errorf("no webhook %s", id)
+	}
+
+	fmt.Printf("Removed webhook %s\n", id)
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jsleep/blog_aggregator/internal/database"
+)
+
+func TestWebhooks(t *testing.T) {
+	s := newTestState(t)
+	registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"))
+	feed := addFeed(t, s, "Example", fs)
+
+	var mu sync.Mutex
+	var received []webhookPayload
+	var signatures []string
+	var bodies [][]byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload webhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, payload)
+		signatures = append(signatures, r.Header.Get(webhookSignatureHeader))
+		bodies = append(bodies, body)
+	}))
+	defer receiver.Close()
+
+	if _, err := run(t, s, "webhook-add", "ftp://example.com"); err == nil {
+		t.Error("expected an error for a non-http url")
+	}
+	if _, err := run(t, s, "webhook-add", "--feed", "https://example.com/unknown.xml", receiver.URL); err == nil {
+		t.Error("expected an error for an unknown feed")
+	}
+
+	out := mustRun(t, s, "webhook-add", "--feed", feed.Url, receiver.URL)
+	id, secret := webhookField(out, "Webhook ", " added"), webhookField(out, "Signing secret: ", "")
+	if id == "" || secret == "" {
+		t.Fatalf("unexpected webhook-add output:\n%s", out)
+	}
+
+	out = mustRun(t, s, "webhooks")
+	if !strings.Contains(out, "* "+id+" "+receiver.URL+" ("+feed.Url+")") {
+		t.Errorf("unexpected webhooks output:\n%s", out)
+	}
+
+	// only posts ingested after the webhook was added are delivered
+	fs.setItems(testItem(1, "One", "first"), testItem(2, "Two", "second"))
+	mustRun(t, s, "agg", "--once")
+	s.webhooks.wait()
+
+	mu.Lock()
+	if len(received) != 1 || received[0].Event != "post.created" || received[0].Post.Title != "Two" || received[0].Feed.URL != feed.Url {
+		t.Errorf("unexpected deliveries: %+v", received)
+	} else if signatures[0] != signWebhook(secret, bodies[0]) {
+		t.Errorf("bad signature %q", signatures[0])
+	}
+	mu.Unlock()
+
+	out = mustRun(t, s, "webhooks")
+	if !strings.Contains(out, "last delivered at") || !strings.Contains(out, "(200)") {
+		t.Errorf("delivery not reported:\n%s", out)
+	}
+
+	// other users can't remove it
+	registerUser(t, s, "bob")
+	if _, err := run(t, s, "webhook-remove", id); err == nil {
+		t.Error("bob removed alice's webhook")
+	}
+	if out := mustRun(t, s, "webhooks"); !strings.Contains(out, "No webhooks") {
+		t.Errorf("bob sees alice's webhooks:\n%s", out)
+	}
+
+	mustRun(t, s, "login", "alice")
+	out = mustRun(t, s, "webhook-remove", id)
+	if !strings.Contains(out, "Removed webhook "+id) {
+		t.Errorf("unexpected webhook-remove output:\n%s", out)
+	}
+	if _, err := run(t, s, "webhook-remove", "nope"); err == nil {
+		t.Error("expected an error for an invalid webhook id")
+	}
+}
+
+// webhookField returns the text between prefix and suffix on the line starting with prefix
+func webhookField(out, prefix, suffix string) string {
+	for _, line := range strings.Split(out, "\n") {
+		if rest, ok := strings.CutPrefix(line, prefix); ok {
+			value, _ := strings.CutSuffix(rest, suffix)
+			return value
+		}
+	}
+	return ""
+}
+
+func TestWebhookRetries(t *testing.T) {
+	s := newTestState(t)
+	alice := registerUser(t, s, "alice")
+	fs := newFeedServer(t, "Example", testItem(1, "One", "first"))
+	feed := addFeed(t, s, "Example", fs)
+	posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{UserID: alice.ID, Limit: 1})
+	if err != nil || len(posts) != 1 {
+		t.Fatalf("no post to deliver: %v", err)
+	}
+	post := database.CreatePostRow{ID: posts[0].ID, FeedID: feed.ID, Title: posts[0].Title, Url: posts[0].Url}
+
+	var mu sync.Mutex
+	var responses []int
+	var attempts int
+	var onRequest func()
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if got := r.Header.Get(webhookSignatureHeader); got != signWebhook(secret, body) {
+			t.Errorf("attempt %d: bad signature %q", attempts, got)
+		}
+		status := http.StatusOK
+		if len(responses) > 0 {
+			status, responses = responses[0], responses[1:]
+		}
+		if onRequest != nil {
+			onRequest()
+		}
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	out := mustRun(t, s, "webhook-add", receiver.URL)
+	hookID, err := uuid.Parse(webhookField(out, "Webhook ", " added"))
+	if err != nil {
+		t.Fatalf("unexpected webhook-add output:\n%s", out)
+	}
+	secret = webhookField(out, "Signing secret: ", "")
+
+	for _, tc := range []struct {
+		name      string
+		responses []int
+		attempts  int
+		status    int32
+	}{
+		{"delivered", nil, 1, http.StatusOK},
+		{"server errors are retried", []int{500, 503}, 3, http.StatusOK},
+		{"throttling is retried", []int{429}, 2, http.StatusOK},
+		{"rejections are not retried", []int{400}, 1, http.StatusBadRequest},
+		{"gives up after the last attempt", []int{500, 500, 500, 500, 500, 500}, webhookMaxAttempts, http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mu.Lock()
+			responses, attempts = tc.responses, 0
+			mu.Unlock()
+
+			s.webhooks.dispatch(context.Background(), s, feed, post)
+			s.webhooks.wait()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if attempts != tc.attempts {
+				t.Errorf("%d attempts, want %d", attempts, tc.attempts)
+			}
+			delivery, err := s.db.GetLastWebhookDelivery(context.Background(), hookID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if delivery.Attempt != int32(tc.attempts) || delivery.StatusCode.Int32 != tc.status {
+				t.Errorf("last delivery: attempt %d status %d", delivery.Attempt, delivery.StatusCode.Int32)
+			}
+		})
+	}
+
+	// shutting down drops the retries instead of waiting them out
+	s.webhooks.retryDelay = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	mu.Lock()
+	responses, attempts, onRequest = []int{500}, 0, cancel
+	mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.webhooks.dispatch(ctx, s, feed, post)
+		s.webhooks.wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait blocked on a retry after shutdown")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 1 {
+		t.Errorf("%d attempts after shutdown, want 1", attempts)
+	}
+}